@@ -17,7 +17,11 @@ func (b Bifrost) newService() bifrost.Service {
 	if cfgDir == "" {
 		cfgDir = b.H.Config()
 	}
-	return ergo.Must1(bifrost.NewService(ergo.Must1(config.Load(cfgDir))))
+	return ergo.Must1(bifrost.NewService(ergo.Must1(config.Load(cfgDir)), loadUser))
+}
+
+func loadUser(dir string) (bifrost.UserConfig, error) {
+	return config.LoadExisting(dir)
 }
 
 func (b Bifrost) Run() error {
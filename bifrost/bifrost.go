@@ -1,11 +1,22 @@
 package bifrost
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/avamsi/heimdall/bifrost/internal/history"
 	"github.com/avamsi/heimdall/bifrost/internal/server"
 	"github.com/avamsi/heimdall/bifrost/internal/service"
 	"github.com/avamsi/heimdall/notifiers"
@@ -15,16 +26,65 @@ import (
 
 type Config interface {
 	BifrostPort() int
-	ChatOptions() (apiKey string, token string, spaceID string, err error)
+	BifrostNetwork() string
+	BifrostSocket() string
+	OwnerUID() int
+	BifrostMultiUser() bool
+	BifrostAdmins() []string
+	BifrostTokens() map[string]string
+	BifrostToken() string
+	Notifiers() (map[string]notifiers.Options, error)
+	OnChange(run func())
 	Dir() string
-	AlwaysNotifyCommands() []string
-	NeverNotifyCommands() []string
+	AlwaysNotify(cmd string) bool
+	NeverNotify(cmd string) bool
+	NotifyTemplate() *template.Template
+	NotifyMinDuration(cmd string) time.Duration
+	NotifySlowFactor() float64
+	HistoryMaxEntries() int
+	HistoryMaxAge() time.Duration
+}
+
+// UserConfig is the config of some other user, as far as a multi-user bifrost
+// cares about it.
+type UserConfig interface {
+	Notifiers() (map[string]notifiers.Options, error)
+	OnChange(run func())
+}
+
+// tokenCreds identifies the client to bifrost by its bifrost.token.
+type tokenCreds struct {
+	token string
+}
+
+func (tc tokenCreds) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + tc.token}, nil
+}
+
+// RequireTransportSecurity is false, since tcp is insecure by choice anyway
+// (and it's all on localhost).
+func (tokenCreds) RequireTransportSecurity() bool {
+	return false
 }
 
 func NewClient(c Config) (pb.BifrostClient, error) {
 	addr := fmt.Sprintf("localhost:%d", c.BifrostPort())
-	creds := grpc.WithTransportCredentials(insecure.NewCredentials())
-	if conn, err := grpc.Dial(addr, creds); err != nil {
+	if c.BifrostNetwork() == "unix" {
+		socket := c.BifrostSocket()
+		// Whoever can put a socket there gets to see (and answer) everything the
+		// client sends, so that had better be bifrost (run as the owner or root).
+		if err := server.CheckSocketDir(filepath.Dir(socket), c.OwnerUID(), 0); err != nil {
+			return nil, err
+		}
+		addr = "unix://" + socket
+	}
+	// There's nothing to secure over a Unix socket, bifrost checks who's on the
+	// other end by their uid instead (and tcp is insecure by choice).
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if token := c.BifrostToken(); token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCreds{token}))
+	}
+	if conn, err := grpc.Dial(addr, opts...); err != nil {
 		return nil, err
 	} else {
 		return pb.NewBifrostClient(conn), nil
@@ -39,14 +99,158 @@ type Service interface {
 	Stop() error
 }
 
-func NewService(c Config) (Service, error) {
-	apiKey, token, spaceID, err := c.ChatOptions()
+// newNotifiers creates the notifiers as per cfgs, which are only trusted with
+// privileged options (see notifiers.Privileged) if they're from bifrost's own
+// config.
+func newNotifiers(cfgs map[string]notifiers.Options, trusted bool) (map[string]server.Notifier, error) {
+	create := notifiers.New
+	if !trusted {
+		create = notifiers.NewUntrusted
+	}
+	ns, err := create(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]server.Notifier{}
+	for name, n := range ns {
+		m[name] = n
+	}
+	return m, nil
+}
+
+// liveNotifiers are the notifiers as per a config, (re)built lazily, on the
+// first use and whenever the config changes.
+type liveNotifiers struct {
+	c       UserConfig
+	trusted bool // see newNotifiers
+
+	mu    sync.Mutex
+	cfgs  map[string]notifiers.Options // that ns were built as per
+	ns    map[string]server.Notifier
+	stale bool
+}
+
+func newLiveNotifiers(c UserConfig, trusted bool) *liveNotifiers {
+	l := &liveNotifiers{c: c, trusted: trusted, stale: true}
+	c.OnChange(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.stale = true
+	})
+	return l
+}
+
+// rebuild rebuilds the notifiers as per the config, keeping the current ones
+// whose options haven't changed (along with, say, the desktop notifier's
+// connection to the bus) and closing the rest. Callers must hold l.mu.
+func (l *liveNotifiers) rebuild() error {
+	cfgs, err := l.c.Notifiers()
+	if err != nil {
+		return err
+	}
+	changed := map[string]notifiers.Options{}
+	for name, opts := range cfgs {
+		if _, ok := l.ns[name]; !ok || !reflect.DeepEqual(opts, l.cfgs[name]) {
+			changed[name] = opts
+		}
+	}
+	ns, err := newNotifiers(changed, l.trusted)
+	if err != nil {
+		return err
+	}
+	for name := range cfgs {
+		if _, ok := changed[name]; !ok {
+			ns[name] = l.ns[name]
+		}
+	}
+	for name, n := range l.ns {
+		if ns[name] == n {
+			continue
+		}
+		if c, ok := n.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("notifier %q: %v", name, err)
+			}
+		}
+	}
+	l.cfgs, l.ns = cfgs, ns
+	return nil
+}
+
+func (l *liveNotifiers) get() (map[string]server.Notifier, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stale {
+		err := l.rebuild()
+		switch {
+		case err == nil:
+			l.stale = false
+		case l.ns == nil:
+			return nil, err
+		default:
+			// Keep going with the current notifiers if the new ones don't work
+			// out (and try again next time).
+			log.Println(err.Error())
+		}
+	}
+	return l.ns, nil
+}
+
+// notifiersOf returns the notifiers to use for the given user (see server.New),
+// which are those of c for bifrost's own user ("") and the owner of c, and in a
+// multi-user bifrost, those of each user as per their own config (loaded, via
+// loadUser, on first use and kept, along with the watch on it, from then on).
+func notifiersOf(c Config, loadUser func(dir string) (UserConfig, error)) (func(string) (map[string]server.Notifier, error), error) {
+	own := newLiveNotifiers(c, true)
+	// Fail early (rather than on the first notification) on a broken config.
+	if _, err := own.get(); err != nil {
+		return nil, err
+	}
+	var (
+		mu     sync.Mutex
+		others = map[string]*liveNotifiers{}
+	)
+	return func(name string) (map[string]server.Notifier, error) {
+		if name == "" || !c.BifrostMultiUser() {
+			return own.get()
+		}
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if u.Uid == strconv.Itoa(c.OwnerUID()) {
+			return own.get()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		l, ok := others[name]
+		if !ok {
+			uc, err := loadUser(filepath.Join(u.HomeDir, ".config"))
+			if err != nil {
+				return nil, err
+			}
+			// Other users' configs can't have bifrost (as root, likely) run
+			// things.
+			l = newLiveNotifiers(uc, false)
+			others[name] = l
+		}
+		return l.get()
+	}, nil
+}
+
+// NewService returns the bifrost service as per c, which (if multi-user) goes
+// by the config of each user (loaded via loadUser) to notify them.
+func NewService(c Config, loadUser func(dir string) (UserConfig, error)) (Service, error) {
+	ns, err := notifiersOf(c, loadUser)
 	if err != nil {
 		return nil, err
 	}
-	if chat, err := notifiers.NewChat(apiKey, token, spaceID); err != nil {
+	h, err := history.Open(filepath.Join(c.Dir(), "heimdall.history"), history.Options{
+		MaxEntries: c.HistoryMaxEntries(),
+		MaxAge:     c.HistoryMaxAge(),
+	})
+	if err != nil {
 		return nil, err
-	} else {
-		return service.New(server.New(c, chat), c.Dir())
 	}
+	return service.New(server.New(c, ns, h), c.Dir())
 }
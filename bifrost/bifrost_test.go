@@ -0,0 +1,143 @@
+package bifrost
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/avamsi/heimdall/notifiers"
+)
+
+type fakeUserConfig struct {
+	cfgs      map[string]notifiers.Options
+	onChanges []func()
+}
+
+func (c *fakeUserConfig) Notifiers() (map[string]notifiers.Options, error) {
+	return c.cfgs, nil
+}
+
+func (c *fakeUserConfig) OnChange(run func()) {
+	c.onChanges = append(c.onChanges, run)
+}
+
+func (c *fakeUserConfig) change(cfgs map[string]notifiers.Options) {
+	c.cfgs = cfgs
+	for _, run := range c.onChanges {
+		run()
+	}
+}
+
+// fakeConfig is a multi-user config owned by owner.
+type fakeConfig struct {
+	Config // just the methods below are implemented
+	*fakeUserConfig
+	owner int
+}
+
+func (c fakeConfig) Notifiers() (map[string]notifiers.Options, error) {
+	return c.fakeUserConfig.Notifiers()
+}
+
+func (c fakeConfig) OnChange(run func()) {
+	c.fakeUserConfig.OnChange(run)
+}
+
+func (c fakeConfig) BifrostMultiUser() bool {
+	return true
+}
+
+func (c fakeConfig) OwnerUID() int {
+	return c.owner
+}
+
+var webhook = map[string]notifiers.Options{"webhook": {"url": "http://127.0.0.1:1/"}}
+
+// otherUser returns the current user, with a config owned by somebody else.
+func otherUser(t *testing.T, own map[string]notifiers.Options) (name string, c fakeConfig) {
+	t.Helper()
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Username, fakeConfig{fakeUserConfig: &fakeUserConfig{cfgs: own}, owner: uid + 1}
+}
+
+func TestOthersCannotExec(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfgs    map[string]notifiers.Options
+		wantErr bool
+	}{
+		{"webhook", webhook, false},
+		{"desktop", map[string]notifiers.Options{"desktop": {}}, false},
+		{"focus-command", map[string]notifiers.Options{"desktop": {"focus-command": "touch /pwned"}}, true},
+		{"address", map[string]notifiers.Options{"desktop": {"address": "unix:path=/tmp/bus"}}, true},
+		{"typed", map[string]notifiers.Options{"d": {"type": "desktop", "focus-command": "touch /pwned"}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// bifrost's own config can have whatever it wants.
+			name, c := otherUser(t, map[string]notifiers.Options{
+				"desktop": {"focus-command": "wmctrl -a heimdall"},
+			})
+			ns, err := notifiersOf(c, func(string) (UserConfig, error) {
+				return &fakeUserConfig{cfgs: test.cfgs}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ns(name); (err != nil) != test.wantErr {
+				t.Errorf("want: error = %v; got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNotifiersOfReload(t *testing.T) {
+	name, c := otherUser(t, webhook)
+	var (
+		loads int
+		uc    = &fakeUserConfig{cfgs: webhook}
+	)
+	ns, err := notifiersOf(c, func(string) (UserConfig, error) {
+		loads++
+		return uc, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := func(user, notifier string) {
+		t.Helper()
+		m, err := ns(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m[notifier]; !ok || len(m) != 1 {
+			t.Errorf("%q: want: just %s; got: %v", user, notifier, m)
+		}
+	}
+	want(name, "webhook")
+	other := map[string]notifiers.Options{"other": {"type": "webhook", "url": "http://127.0.0.1:2/"}}
+	uc.change(other)
+	want(name, "other")
+	// Notifiers whose options haven't changed are kept as is.
+	before, _ := ns(name)
+	uc.change(map[string]notifiers.Options{"other": {"type": "webhook", "url": "http://127.0.0.1:2/"}})
+	if after, _ := ns(name); after["other"] != before["other"] {
+		t.Errorf("want: %p kept; got: %p", before["other"], after["other"])
+	}
+	// A broken config keeps the current notifiers going.
+	uc.change(map[string]notifiers.Options{"broken": {"type": "nope"}})
+	want(name, "other")
+	if loads != 1 {
+		t.Errorf("want: 1 load; got: %d", loads)
+	}
+	want("", "webhook")
+	c.change(map[string]notifiers.Options{"own": {"type": "webhook", "url": "http://127.0.0.1:3/"}})
+	want("", "own")
+}
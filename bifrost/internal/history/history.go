@@ -0,0 +1,214 @@
+// Package history persists finished commands as an append-only log of JSON
+// lines, compacting it every so often to stay within the configured retention.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/avamsi/ergo"
+)
+
+type Entry struct {
+	ID         string    `json:"id"`
+	Command    string    `json:"command"`
+	StartTime  time.Time `json:"start_time,omitempty"`
+	EndTime    time.Time `json:"end_time"`
+	ReturnCode int32     `json:"return_code"`
+	Username   string    `json:"username,omitempty"`
+	Hostname   string    `json:"hostname,omitempty"`
+	Cwd        string    `json:"cwd,omitempty"`
+	Notified   bool      `json:"notified"`
+	Reason     string    `json:"reason,omitempty"` // why it was (or wasn't) notified on
+}
+
+// Duration returns how long the command ran for (or 0 if it's not known).
+func (e *Entry) Duration() time.Duration {
+	if e.StartTime.IsZero() {
+		return 0
+	}
+	return e.EndTime.Sub(e.StartTime)
+}
+
+type Options struct {
+	MaxEntries int           // 0 means no limit
+	MaxAge     time.Duration // 0 means no limit
+}
+
+// Store keeps (a retained window of) the log in memory too, so reads don't have
+// to go to disk.
+type Store struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	f       *os.File
+	entries []Entry
+	lines   int // number of lines in the file (>= len(entries))
+}
+
+func (s *Store) retain(now time.Time) {
+	i := 0
+	if s.opts.MaxAge > 0 {
+		cutoff := now.Add(-s.opts.MaxAge)
+		for i < len(s.entries) && s.entries[i].EndTime.Before(cutoff) {
+			i++
+		}
+	}
+	if s.opts.MaxEntries > 0 && len(s.entries)-i > s.opts.MaxEntries {
+		i = len(s.entries) - s.opts.MaxEntries
+	}
+	s.entries = s.entries[i:]
+}
+
+// compact rewrites the file with just the retained entries (atomically, by
+// writing to a temporary file and renaming it over). Requires s.mu.
+func (s *Store) compact() (err error) {
+	defer ergo.Annotate(&err, "failed to compact history")
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for i := range s.entries {
+		if err := enc.Encode(&s.entries[i]); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	if s.f != nil {
+		s.f.Close()
+	}
+	s.f, s.lines = tmp, len(s.entries)
+	return nil
+}
+
+// needsCompaction reports whether enough of the file is garbage to be worth
+// rewriting (so that we don't rewrite the whole file on every append).
+func (s *Store) needsCompaction() bool {
+	return s.lines-len(s.entries) > max(len(s.entries)/2, 42)
+}
+
+// maxLine is the longest line load reads (rather than skips).
+const maxLine = 1 << 20
+
+func (s *Store) load() (err error) {
+	defer ergo.Annotate(&err, "failed to load history")
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, maxLine)
+	for {
+		line, err := r.ReadSlice('\n')
+		// A line too long to read (say, of a huge command pasted in whole) is
+		// skipped, like a corrupt one (see below), rather than failing the load.
+		tooLong := false
+		for errors.Is(err, bufio.ErrBufferFull) {
+			tooLong = true
+			_, err = r.ReadSlice('\n')
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		switch {
+		case tooLong:
+			s.lines++
+			log.Printf("skipping history line %d: longer than %d bytes\n", s.lines, maxLine)
+		case len(line) > 0:
+			s.lines++
+			var e Entry
+			// A partially written line (say, from a crash) shouldn't lose us
+			// the rest of the history, so just skip it (it'll be compacted
+			// away).
+			if err := json.Unmarshal(line, &e); err != nil {
+				log.Printf("skipping history line %d: %v\n", s.lines, err)
+				break
+			}
+			s.entries = append(s.entries, e)
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func Open(path string, opts Options) (_ *Store, err error) {
+	defer ergo.Annotate(&err, "failed to open history")
+	s := &Store{path: path, opts: opts}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.retain(time.Now())
+	if s.lines > len(s.entries) {
+		return s, s.compact()
+	}
+	s.f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	return s, err
+}
+
+// Append appends the entry to the log, compacting it if need be.
+func (s *Store) Append(e Entry) (err error) {
+	defer ergo.Annotate(&err, "failed to append to history")
+	b, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, e)
+	s.lines++
+	s.retain(time.Now())
+	if s.needsCompaction() {
+		return s.compact()
+	}
+	return nil
+}
+
+// Entries returns (a copy of) all the retained entries, oldest first.
+func (s *Store) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.entries...)
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,137 @@
+package history
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ids returns the ids of the entries, in order.
+func ids(entries []Entry) string {
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+// lines returns the number of lines in the file at path.
+func lines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	n := 0
+	for {
+		if _, err := r.ReadString('\n'); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func open(t *testing.T, path string, opts Options) *Store {
+	t.Helper()
+	s, err := Open(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRetain(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{ID: "1", EndTime: now.Add(-3 * time.Hour)},
+		{ID: "2", EndTime: now.Add(-2 * time.Hour)},
+		{ID: "3", EndTime: now.Add(-time.Hour)},
+		{ID: "4", EndTime: now},
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"no limits", Options{}, "1,2,3,4"},
+		{"max-entries", Options{MaxEntries: 2}, "3,4"},
+		{"max-age", Options{MaxAge: 150 * time.Minute}, "2,3,4"},
+		{"both", Options{MaxEntries: 2, MaxAge: 150 * time.Minute}, "3,4"},
+		{"both, age wins", Options{MaxEntries: 3, MaxAge: 90 * time.Minute}, "3,4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Store{opts: test.opts, entries: append([]Entry(nil), entries...)}
+			s.retain(now)
+			if got := ids(s.entries); got != test.want {
+				t.Errorf("want: %s; got: %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestAppendCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heimdall.history")
+	s := open(t, path, Options{MaxEntries: 10})
+	for i := 0; i < 100; i++ {
+		if err := s.Append(Entry{ID: fmt.Sprint(i), EndTime: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		// Never more than 42 lines of garbage (see needsCompaction).
+		if n := lines(t, path); n > 10+42+1 {
+			t.Fatalf("after %d appends: want: compacted; got: %d lines", i+1, n)
+		}
+	}
+	if got, want := ids(s.Entries()), "90,91,92,93,94,95,96,97,98,99"; got != want {
+		t.Errorf("want: %s; got: %s", want, got)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heimdall.history")
+	s := open(t, path, Options{})
+	for i := 0; i < 3; i++ {
+		if err := s.Append(Entry{ID: fmt.Sprint(i), Command: "make", EndTime: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A partially written line, an oversized one and an empty one, none of
+	// which should keep the rest of the history from loading.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "{\"id\": \"4\", \"comm\n")
+	fmt.Fprintf(f, "{\"id\": \"5\", \"command\": %q}\n", strings.Repeat("x", maxLine))
+	fmt.Fprintf(f, "\n")
+	fmt.Fprintf(f, "{\"id\": \"6\", \"command\": \"make\"}\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = open(t, path, Options{})
+	if got, want := ids(s.Entries()), "0,1,2,6"; got != want {
+		t.Errorf("want: %s; got: %s", want, got)
+	}
+	// The lines that couldn't be loaded are compacted away on open.
+	if n := lines(t, path); n != 4 {
+		t.Errorf("want: 4 lines; got: %d", n)
+	}
+	if err := s.Append(Entry{ID: "7", EndTime: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s = open(t, path, Options{MaxEntries: 2})
+	if got, want := ids(s.Entries()), "6,7"; got != want {
+		t.Errorf("want: %s; got: %s", want, got)
+	}
+}
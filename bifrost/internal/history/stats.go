@@ -0,0 +1,48 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+type Stats struct {
+	Count     int // number of runs
+	Successes int // number of runs that exited 0
+	// Percentiles of the durations of the runs, only counting the runs with a
+	// known duration (i.e., start time).
+	P50, P90, Max time.Duration
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	// Nearest-rank, i.e., the smallest duration that's >= p% of all of them.
+	i := (p*len(sorted) + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i]
+}
+
+// Summarize computes the stats of the given entries (in any order).
+func Summarize(entries []Entry) Stats {
+	var (
+		s  = Stats{Count: len(entries)}
+		ds = []time.Duration{}
+	)
+	for i := range entries {
+		if entries[i].ReturnCode == 0 {
+			s.Successes++
+		}
+		if d := entries[i].Duration(); d > 0 {
+			ds = append(ds, d)
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	s.P50, s.P90 = percentile(ds, 50), percentile(ds, 90)
+	if len(ds) > 0 {
+		s.Max = ds[len(ds)-1]
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ds := func(ss ...int) []time.Duration {
+		var ds []time.Duration
+		for _, s := range ss {
+			ds = append(ds, time.Duration(s)*time.Second)
+		}
+		return ds
+	}
+	tests := []struct {
+		sorted []time.Duration
+		p      int
+		want   time.Duration
+	}{
+		{nil, 50, 0},
+		{ds(7), 50, 7 * time.Second},
+		{ds(7), 90, 7 * time.Second},
+		{ds(1, 2), 50, 1 * time.Second},
+		{ds(1, 2, 3, 4), 50, 2 * time.Second},
+		{ds(1, 2, 3, 4, 5), 50, 3 * time.Second},
+		{ds(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 90, 9 * time.Second},
+		{ds(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11), 90, 10 * time.Second},
+		{ds(1, 2, 3), 0, 1 * time.Second},
+		{ds(1, 2, 3), 100, 3 * time.Second},
+	}
+	for _, test := range tests {
+		if got := percentile(test.sorted, test.p); got != test.want {
+			t.Errorf("p%d of %v: want: %v; got: %v", test.p, test.sorted, test.want, got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2022, 9, 13, 15, 4, 5, 0, time.UTC)
+	entry := func(d time.Duration, code int32) Entry {
+		return Entry{StartTime: start, EndTime: start.Add(d), ReturnCode: code}
+	}
+	entries := []Entry{
+		entry(3*time.Second, 0),
+		entry(time.Second, 1),
+		entry(2*time.Second, 0),
+		{EndTime: start, ReturnCode: 0}, // unknown duration
+		entry(10*time.Second, 0),
+	}
+	want := Stats{Count: 5, Successes: 4, P50: 2 * time.Second, P90: 10 * time.Second, Max: 10 * time.Second}
+	if got := Summarize(entries); got != want {
+		t.Errorf("want: %+v; got: %+v", want, got)
+	}
+	if got := Summarize(nil); got != (Stats{}) {
+		t.Errorf("want: zero stats; got: %+v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"time"
+
+	pb "github.com/avamsi/heimdall/bifrost/proto"
+)
+
+type Config interface {
+	AlwaysNotify(cmd string) bool
+	NeverNotify(cmd string) bool
+	NotifyMinDuration(cmd string) time.Duration
+}
+
+// Reason is why a command was (or wasn't) notified on.
+type Reason int
+
+const (
+	Unknown        Reason = iota // the command or its start time isn't known
+	Forced                       // HEIMDALL_FORCE_NOTIFY was set
+	AlwaysList                   // the command is in commands.always-notify
+	NeverList                    // the command is in commands.never-notify
+	Interrupted                  // the command was interrupted (i.e., Ctrl-C)
+	TooShort                     // the command ran for less than min-duration
+	UserInteracted               // the user interacted within min-duration
+	LongRunning                  // the command ran for at least min-duration
+	Muted                        // the command was muted (i.e., from heimdall top)
+)
+
+var reasons = [...]string{
+	Unknown:        "unknown",
+	Forced:         "forced",
+	AlwaysList:     "always-list",
+	NeverList:      "never-list",
+	Interrupted:    "interrupted",
+	TooShort:       "too-short",
+	UserInteracted: "user-interacted",
+	LongRunning:    "long-running",
+	Muted:          "muted",
+}
+
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(reasons) {
+		return reasons[Unknown]
+	}
+	return reasons[r]
+}
+
+type Decision struct {
+	Notify bool
+	Reason Reason
+}
+
+func (d Decision) String() string {
+	if d.Notify {
+		return "notify (" + d.Reason.String() + ")"
+	}
+	return "don't notify (" + d.Reason.String() + ")"
+}
+
+// Decide decides whether to notify on a command that started at start and
+// ended at end (as per req), in that order of precedence --
+//
+//  1. notify if forced (i.e., HEIMDALL_FORCE_NOTIFY)
+//  2. don't notify if the command was muted
+//  3. don't notify if the command was interrupted by the user
+//  4. notify if the command is in commands.always-notify
+//  5. don't notify if the command is in commands.never-notify
+//  6. don't notify if the command ran for less than min-duration or the user
+//     interacted with it (i.e., the command accessed stdin) in the last
+//     min-duration and notify otherwise.
+//
+// start may be zero if it's not known (in which case, only 1 -- 5 apply).
+func Decide(c Config, req *pb.CommandEndRequest, start, end time.Time, muted bool) Decision {
+	if req.GetForceNotify() {
+		return Decision{true, Forced}
+	}
+	if muted {
+		return Decision{false, Muted}
+	}
+	if req.GetReturnCode() == 130 {
+		return Decision{false, Interrupted}
+	}
+	cmd := req.GetCommand().GetCommand()
+	if cmd == "" {
+		return Decision{false, Unknown}
+	}
+	if c.AlwaysNotify(cmd) {
+		return Decision{true, AlwaysList}
+	}
+	if c.NeverNotify(cmd) {
+		return Decision{false, NeverList}
+	}
+	if start.IsZero() {
+		return Decision{false, Unknown}
+	}
+	minDuration := c.NotifyMinDuration(cmd)
+	if end.Sub(start) < minDuration {
+		return Decision{false, TooShort}
+	}
+	if i := req.GetLastInteractionTime().AsTime(); i.After(start) && end.Sub(i) < minDuration {
+		return Decision{false, UserInteracted}
+	}
+	return Decision{true, LongRunning}
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/avamsi/heimdall/bifrost/proto"
+)
+
+type fakeConfig struct {
+	always, never map[string]bool
+	minDuration   time.Duration
+}
+
+func (c fakeConfig) AlwaysNotify(cmd string) bool {
+	return c.always[cmd]
+}
+
+func (c fakeConfig) NeverNotify(cmd string) bool {
+	return c.never[cmd]
+}
+
+func (c fakeConfig) NotifyMinDuration(string) time.Duration {
+	return c.minDuration
+}
+
+func TestDecide(t *testing.T) {
+	c := fakeConfig{
+		always:      map[string]bool{"deploy": true},
+		never:       map[string]bool{"vim": true},
+		minDuration: time.Minute,
+	}
+	end := time.Date(2022, 9, 13, 15, 4, 5, 0, time.UTC)
+	long, short := end.Add(-time.Hour), end.Add(-time.Second)
+	type request struct {
+		cmd         string
+		code        int32
+		force       bool
+		interaction time.Time
+	}
+	tests := []struct {
+		name  string
+		req   request
+		start time.Time
+		muted bool
+		want  Decision
+	}{
+		{"forced", request{cmd: "sleep", force: true}, short, false, Decision{true, Forced}},
+		{"forced beats muted", request{cmd: "sleep", force: true}, long, true, Decision{true, Forced}},
+		{"muted", request{cmd: "sleep"}, long, true, Decision{false, Muted}},
+		{"muted beats always-list", request{cmd: "deploy"}, long, true, Decision{false, Muted}},
+		{"interrupted", request{cmd: "sleep", code: 130}, long, false, Decision{false, Interrupted}},
+		{"interrupted beats always-list", request{cmd: "deploy", code: 130}, long, false, Decision{false, Interrupted}},
+		{"always-list", request{cmd: "deploy"}, short, false, Decision{true, AlwaysList}},
+		{"always-list without start", request{cmd: "deploy"}, time.Time{}, false, Decision{true, AlwaysList}},
+		{"never-list", request{cmd: "vim"}, long, false, Decision{false, NeverList}},
+		{"too-short", request{cmd: "sleep"}, short, false, Decision{false, TooShort}},
+		{"too-short failure", request{cmd: "sleep", code: 1}, short, false, Decision{false, TooShort}},
+		{"user-interacted", request{cmd: "sleep", interaction: end.Add(-time.Second)}, long, false, Decision{false, UserInteracted}},
+		{"interacted long ago", request{cmd: "sleep", interaction: end.Add(-time.Minute)}, long, false, Decision{true, LongRunning}},
+		{"interacted before start", request{cmd: "sleep", interaction: long.Add(-time.Second)}, long, false, Decision{true, LongRunning}},
+		{"long-running", request{cmd: "sleep"}, long, false, Decision{true, LongRunning}},
+		{"unknown start", request{cmd: "sleep"}, time.Time{}, false, Decision{false, Unknown}},
+		{"unknown command", request{}, long, false, Decision{false, Unknown}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := &pb.CommandEndRequest{
+				Command:     &pb.Command{Command: test.req.cmd},
+				ReturnCode:  test.req.code,
+				ForceNotify: test.req.force,
+			}
+			if !test.req.interaction.IsZero() {
+				req.LastInteractionTime = timestamppb.New(test.req.interaction)
+			}
+			if got := Decide(c, req, test.start, end, test.muted); got != test.want {
+				t.Errorf("want: %s; got: %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// identity is who's on the other end of an RPC, as far as bifrost can tell.
+type identity struct {
+	// user namespaces everything bifrost keeps (running commands, cache and
+	// such), which is "" (i.e., there's just the one namespace) unless bifrost
+	// is multi-user.
+	user  string
+	uid   int // -1 if not known (say, the user was identified by a token)
+	admin bool
+}
+
+// sees reports whether the identity can see what's namespaced under user.
+func (id identity) sees(user string) bool {
+	return id.user == "" || id.user == user
+}
+
+// scope returns the identity to list as, which sees across users if asked to
+// (and if it's allowed to).
+func (id identity) scope(allUsers bool) (identity, error) {
+	if !allUsers {
+		return id, nil
+	}
+	if !id.admin {
+		return identity{}, status.Errorf(codes.PermissionDenied, "all_users: want: admin; got: %s", id.user)
+	}
+	id.user = ""
+	return id, nil
+}
+
+type identityKey struct{}
+
+// identityFrom returns the identity of the caller, as set by the interceptors
+// (see unaryIdentity and streamIdentity).
+func identityFrom(ctx context.Context) identity {
+	return ctx.Value(identityKey{}).(identity)
+}
+
+// authenticate returns the user on the other end, going by their peer
+// credentials (over unix, see peerCreds) or their token (over tcp, if there
+// are any bifrost.tokens). name is "" if the user isn't known by name.
+func (b *bifrost) authenticate(ctx context.Context) (name string, uid int, err error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(peerInfo); ok {
+			uid := int(info.uid)
+			if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+				return u.Username, uid, nil
+			}
+			return "", uid, nil
+		}
+	}
+	tokens := b.config.BifrostTokens()
+	if len(tokens) == 0 {
+		return "", -1, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token := strings.TrimPrefix(v, "Bearer ")
+		for name, t := range tokens {
+			if t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				uid := -1
+				if u, err := user.Lookup(name); err == nil {
+					uid, _ = strconv.Atoi(u.Uid)
+				}
+				return name, uid, nil
+			}
+		}
+	}
+	if len(md.Get("authorization")) == 0 {
+		return "", 0, status.Error(codes.Unauthenticated, "want: a token from bifrost.tokens; got: none")
+	}
+	return "", 0, status.Error(codes.Unauthenticated, "want: a token from bifrost.tokens; got: an unknown one")
+}
+
+func (b *bifrost) identify(ctx context.Context) (identity, error) {
+	name, uid, err := b.authenticate(ctx)
+	if err != nil {
+		return identity{}, err
+	}
+	if !b.config.BifrostMultiUser() {
+		// Everyone that got in (see peerCreds) is as good as the owner.
+		return identity{uid: uid, admin: true}, nil
+	}
+	if name == "" {
+		return identity{}, status.Errorf(codes.Unauthenticated, "want: a known user; got: uid %d", uid)
+	}
+	id := identity{user: name, uid: uid, admin: uid == 0 || uid == b.owner}
+	for _, admin := range b.config.BifrostAdmins() {
+		id.admin = id.admin || admin == name
+	}
+	return id, nil
+}
+
+func (b *bifrost) unaryIdentity(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id, err := b.identify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, identityKey{}, id), req)
+}
+
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s identifiedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (b *bifrost) streamIdentity(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id, err := b.identify(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, identifiedStream{ss, context.WithValue(ss.Context(), identityKey{}, id)})
+}
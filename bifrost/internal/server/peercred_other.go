@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// peerCred isn't supported here, so Unix socket connections are all rejected
+// (consider bifrost.network: tcp instead).
+func peerCred(*net.UnixConn) (uid uint32, err error) {
+	return 0, fmt.Errorf("peer credentials aren't supported on %s", runtime.GOOS)
+}
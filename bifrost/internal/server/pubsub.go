@@ -0,0 +1,52 @@
+package server
+
+import (
+	"sync"
+
+	pb "github.com/avamsi/heimdall/bifrost/proto"
+)
+
+// subscriberBuffer is how many events a subscriber can fall behind by before
+// it's dropped (see publish).
+const subscriberBuffer = 42
+
+// pubsub broadcasts command lifecycle events to all of its subscribers.
+type pubsub struct {
+	mu   sync.Mutex
+	subs map[chan *pb.WatchResponse]nothing
+}
+
+// subscribe returns a channel of all the events published from now on, which
+// is closed on unsubscribe (or if the subscriber falls behind, see publish).
+func (ps *pubsub) subscribe() (events <-chan *pb.WatchResponse, unsubscribe func()) {
+	ch := make(chan *pb.WatchResponse, subscriberBuffer)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.subs == nil {
+		ps.subs = map[chan *pb.WatchResponse]nothing{}
+	}
+	ps.subs[ch] = nothing{}
+	return ch, func() {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		if _, ok := ps.subs[ch]; ok {
+			delete(ps.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish never blocks, so a subscriber that falls behind (i.e., its buffer is
+// full) is dropped instead (and can tell so from its channel being closed).
+func (ps *pubsub) publish(e *pb.WatchResponse) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for ch := range ps.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(ps.subs, ch)
+			close(ch)
+		}
+	}
+}
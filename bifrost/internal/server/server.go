@@ -4,32 +4,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net"
+	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/rs/xid"
 	"golang.org/x/exp/constraints"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/avamsi/ergo"
+	"github.com/avamsi/heimdall/bifrost/internal/history"
+	"github.com/avamsi/heimdall/bifrost/internal/policy"
+	"github.com/avamsi/heimdall/notifiers"
 
 	pb "github.com/avamsi/heimdall/bifrost/proto"
 )
 
-func anyOf[T any](s []T, pred func(T) bool) bool {
-	for _, i := range s {
-		if pred(i) {
-			return true
-		}
-	}
-	return false
-}
-
 func max[T constraints.Ordered](a, b T) T {
 	if a > b {
 		return a
@@ -46,19 +53,39 @@ func min[T constraints.Ordered](a, b T) T {
 
 type Config interface {
 	BifrostPort() int
-	AlwaysNotifyCommands() []string
-	NeverNotifyCommands() []string
+	BifrostNetwork() string
+	BifrostSocket() string
+	OwnerUID() int
+	AlwaysNotify(cmd string) bool
+	NeverNotify(cmd string) bool
+	NotifyTemplate() *template.Template
+	NotifyMinDuration(cmd string) time.Duration
+	NotifySlowFactor() float64
+	BifrostMultiUser() bool
+	BifrostAdmins() []string
+	BifrostTokens() map[string]string
 }
 
 type Notifier interface {
-	Notify(ctx context.Context, msg string) (err error)
+	Notify(ctx context.Context, e *notifiers.Event) (err error)
 }
 
 type nothing struct{}
 
-type command struct {
-	*pb.Command
-	done chan nothing
+// key identifies a command (or a cached command, by its full command line),
+// which is only unique per user (see identity).
+type key struct {
+	user, id string
+}
+
+// notification is an event to be notified on, to the notifiers of user.
+type notification struct {
+	e *notifiers.Event
+	// The command (as it was running, see finish) and its result, for the
+	// NOTIFIED event.
+	cmd    *pb.Command
+	result *pb.CommandResult
+	user   string
 }
 
 type syncCachedCommand struct {
@@ -71,25 +98,46 @@ type syncCachedCommand struct {
 
 type bifrost struct {
 	pb.UnimplementedBifrostServer
-	config          Config
-	notifier        Notifier
-	msgs            chan string
+	config Config
+	owner  int // uid of the user owning the config
+	// notifiers returns the notifiers (keyed by name) of the given user (see
+	// identity), or bifrost's own for "".
+	notifiers func(user string) (map[string]Notifier, error)
+	events    chan notification
+	history   *history.Store
+	// pubsub broadcasts STARTED and ENDED events (under syncRunningCmds, so
+	// that subscribing and reading syncRunningCmds under it is atomic) and
+	// NOTIFIED events.
+	pubsub          pubsub
 	syncRunningCmds struct {
 		sync.Mutex
-		m map[string]command // string is the command ID
+		m     map[key]*pb.Command
+		muted map[key]bool
+		// Results of the recently finished commands (see recentTTL), so that
+		// WaitForCommand can return them even if called after the fact.
+		recent map[key]*pb.CommandResult
 	}
 	syncCachedCmds struct {
 		sync.Mutex
-		m map[string]*syncCachedCommand // string is the full command
+		m map[key]*syncCachedCommand // key.id is the full command
 	}
 }
 
-func (b *bifrost) commandStartAsync(req *pb.CommandStartRequest, id string) {
+func (b *bifrost) commandStart(req *pb.CommandStartRequest, id string, user string) {
 	cmd := req.GetCommand()
 	cmd.Id = id
+	if user != "" {
+		// Don't take the client's word for it in a multi-user bifrost.
+		cmd.Username = user
+	}
 	b.syncRunningCmds.Lock()
 	defer b.syncRunningCmds.Unlock()
-	b.syncRunningCmds.m[id] = command{cmd, make(chan nothing)}
+	b.syncRunningCmds.m[key{user, id}] = cmd
+	b.pubsub.publish(&pb.WatchResponse{
+		Type:    pb.WatchResponse_STARTED,
+		Command: cmd,
+		Time:    timestamppb.Now(),
+	})
 }
 
 func (b *bifrost) CommandStart(todo context.Context, req *pb.CommandStartRequest) (*pb.CommandStartResponse, error) {
@@ -97,15 +145,18 @@ func (b *bifrost) CommandStart(todo context.Context, req *pb.CommandStartRequest
 	if id == "" {
 		id = xid.New().String()
 	}
-	go b.commandStartAsync(req, id)
+	// Synchronously (unlike CommandEnd), so that the command is running by the
+	// time the caller gets to end it (and an end can't overtake its start,
+	// leaving the command running forever).
+	b.commandStart(req, id, identityFrom(todo).user)
 	return &pb.CommandStartResponse{Id: id}, nil
 }
 
-func (b *bifrost) startTime(cmd *pb.Command) *timestamppb.Timestamp {
+func (b *bifrost) startTime(user string, cmd *pb.Command) *timestamppb.Timestamp {
 	if !cmd.ProtoReflect().Has(cmd.ProtoReflect().Descriptor().Fields().ByNumber(2)) {
 		b.syncRunningCmds.Lock()
 		defer b.syncRunningCmds.Unlock()
-		if cmd, ok := b.syncRunningCmds.m[cmd.GetId()]; ok {
+		if cmd, ok := b.syncRunningCmds.m[key{user, cmd.GetId()}]; ok {
 			return cmd.GetStartTime()
 		}
 		return nil
@@ -113,88 +164,478 @@ func (b *bifrost) startTime(cmd *pb.Command) *timestamppb.Timestamp {
 	return cmd.GetStartTime()
 }
 
-func (b *bifrost) commandEndAsync(req *pb.CommandEndRequest) {
-	defer func() {
+func (b *bifrost) cwd(user string, cmd *pb.Command) string {
+	if cmd.GetCwd() == "" {
 		b.syncRunningCmds.Lock()
 		defer b.syncRunningCmds.Unlock()
-		if cmd, ok := b.syncRunningCmds.m[req.GetCommand().GetId()]; ok {
-			// This unblocks any goroutines waiting in WaitForCommand below.
-			close(cmd.done)
-			delete(b.syncRunningCmds.m, cmd.GetId())
+		if cmd, ok := b.syncRunningCmds.m[key{user, cmd.GetId()}]; ok {
+			return cmd.GetCwd()
+		}
+	}
+	return cmd.GetCwd()
+}
+
+// usualRuns returns the previous runs of the command that make up what's usual
+// for it, for the purposes of ETAs and such. Failed runs tend to be fast (or
+// otherwise unrepresentative), so only the successful runs count.
+func (b *bifrost) usualRuns(user, cmd string) []history.Entry {
+	return b.usualRunsOf(map[string]bool{cmd: true})[runsKey{user, cmd}]
+}
+
+type runsKey struct {
+	user, cmd string
+}
+
+// usualRunsOf is usualRuns for several commands at once, reading the history
+// just once. The runs are indexed by user (with "" seeing across users, as with
+// identity.sees) and command.
+func (b *bifrost) usualRunsOf(cmds map[string]bool) map[runsKey][]history.Entry {
+	runs := map[runsKey][]history.Entry{}
+	for _, e := range b.history.Entries() {
+		if !cmds[e.Command] || e.ReturnCode != 0 || e.Duration() <= 0 {
+			continue
+		}
+		k := runsKey{e.Username, e.Command}
+		runs[k] = append(runs[k], e)
+		if e.Username != "" {
+			k.user = ""
+			runs[k] = append(runs[k], e)
 		}
-	}()
-	// Don't notify if the command was interrupted by the user.
-	if req.GetReturnCode() == 130 {
-		return
 	}
+	return runs
+}
+
+// minSlowSamples is the minimum number of previous (successful) runs needed to
+// tell whether a run is slower than usual.
+const minSlowSamples = 5
+
+// slowerBy returns how many times slower than usual (its historical p90) the
+// command ran for d, or 0 if it's not notably so (as per notify.slow-factor).
+func (b *bifrost) slowerBy(user, cmd string, d time.Duration) float64 {
+	factor := b.config.NotifySlowFactor()
+	if factor == 0 || d == 0 {
+		return 0
+	}
+	runs := b.usualRuns(user, cmd)
+	if len(runs) < minSlowSamples {
+		return 0
+	}
+	p90 := history.Summarize(runs).P90
+	if x := float64(d) / float64(p90); x >= factor {
+		return x
+	}
+	return 0
+}
+
+// recentTTL is how long the results of finished commands are kept around in
+// memory for WaitForCommand (after which, it falls back to the history).
+const recentTTL = time.Hour
+
+// finish records the result of the command and lets everyone (i.e., those in
+// WaitForCommand and Watch) know that it's done running, returning the command
+// as it was running (which has more to it, if known).
+func (b *bifrost) finish(user string, cmd *pb.Command, result *pb.CommandResult) *pb.Command {
+	k := key{user, cmd.GetId()}
+	if k.id == "" {
+		return cmd
+	}
+	b.syncRunningCmds.Lock()
+	defer b.syncRunningCmds.Unlock()
+	for k, r := range b.syncRunningCmds.recent {
+		if time.Since(r.GetEndTime().AsTime()) > recentTTL {
+			delete(b.syncRunningCmds.recent, k)
+		}
+	}
+	b.syncRunningCmds.recent[k] = result
+	// The running command (if known) has more to it than what's in the
+	// CommandEndRequest (cwd, for example).
+	if running, ok := b.syncRunningCmds.m[k]; ok {
+		cmd = running
+		delete(b.syncRunningCmds.m, k)
+	}
+	delete(b.syncRunningCmds.muted, k)
+	b.pubsub.publish(&pb.WatchResponse{
+		Type:    pb.WatchResponse_ENDED,
+		Command: cmd,
+		Time:    result.GetEndTime(),
+		Result:  result,
+	})
+	return cmd
+}
+
+func (b *bifrost) commandEndAsync(req *pb.CommandEndRequest, id identity) {
 	cmd := req.GetCommand()
-	if cmd.GetCommand() == "" {
-		return
+	if id.user != "" {
+		cmd.Username, req.Username = id.user, id.user
 	}
-	isPrefixOfCmd := func(prefix string) bool {
-		return strings.HasPrefix(cmd.GetCommand(), prefix)
+	end := time.Now()
+	var (
+		start    time.Time
+		duration time.Duration
+	)
+	if t := b.startTime(id.user, cmd); t != nil {
+		start = t.AsTime().Local()
+		duration = end.Sub(start).Round(time.Second)
 	}
-	// Don't notify if the user requested to never be notified for the command
-	// (unless the user requested to always be notified for it).
-	alwaysNotify := anyOf(b.config.AlwaysNotifyCommands(), isPrefixOfCmd)
-	if !alwaysNotify && anyOf(b.config.NeverNotifyCommands(), isPrefixOfCmd) {
-		return
+	d := policy.Decide(b.config, req, start, end, b.muted(key{id.user, cmd.GetId()}))
+	log.Printf("%s: %s\n", cmd.GetId(), d)
+	e := &notifiers.Event{
+		Command:    cmd.GetCommand(),
+		ID:         cmd.GetId(),
+		StartTime:  start,
+		Duration:   duration,
+		ReturnCode: req.GetReturnCode(),
+		Username:   req.GetUsername(),
+		Hostname:   req.GetHostname(),
+		Cwd:        b.cwd(id.user, cmd),
+		Reason:     d.Reason.String(),
+		SlowerBy:   b.slowerBy(id.user, cmd.GetCommand(), duration),
 	}
-	// Don't notify if the command ran or the user interacted with it (i.e.,
-	// the command accessed stdin) in the last 42 seconds.
-	t := b.startTime(cmd)
-	if t == nil {
-		return
+	err := b.history.Append(history.Entry{
+		ID:         e.ID,
+		Command:    e.Command,
+		StartTime:  start,
+		EndTime:    end,
+		ReturnCode: e.ReturnCode,
+		Username:   e.Username,
+		Hostname:   e.Hostname,
+		Cwd:        e.Cwd,
+		Notified:   d.Notify,
+		Reason:     e.Reason,
+	})
+	if err != nil {
+		log.Println(err.Error())
 	}
-	start := t.AsTime().Local()
-	interaction := time.Since(start).Round(time.Second)
-	if i := req.GetLastInteractionTime().AsTime(); i.After(start) {
-		interaction = time.Since(start).Round(time.Second)
+	result := &pb.CommandResult{
+		Id:         cmd.GetId(),
+		ReturnCode: req.GetReturnCode(),
+		EndTime:    timestamppb.New(end),
 	}
-	// TODO: this "42" should be configurable and not a magic number.
-	if interaction < 42*time.Second {
+	if !start.IsZero() {
+		result.Duration = durationpb.New(end.Sub(start))
+	}
+	// Finish before notifying, which may well block (on a backed up events
+	// channel) and shouldn't hold up the waiters.
+	cmd = b.finish(id.user, cmd, result)
+	if !d.Notify {
 		return
 	}
-	ts := start.Format(time.Kitchen)
-	ds := time.Since(start).Round(time.Second).String()
-	rc := ""
-	if req.GetReturnCode() != 0 {
-		rc = fmt.Sprintf(" -> 🙅:%d", req.GetReturnCode())
+	if t := b.config.NotifyTemplate(); t != nil {
+		var msg strings.Builder
+		if err := t.Execute(&msg, e); err != nil {
+			log.Println(err.Error())
+		} else {
+			e.Message = msg.String()
+		}
+	}
+	b.events <- notification{e, cmd, result, id.user}
+}
+
+func (b *bifrost) muted(k key) bool {
+	b.syncRunningCmds.Lock()
+	defer b.syncRunningCmds.Unlock()
+	return b.syncRunningCmds.muted[k]
+}
+
+func (b *bifrost) MuteCommand(todo context.Context, req *pb.MuteCommandRequest) (*pb.MuteCommandResponse, error) {
+	k := key{identityFrom(todo).user, req.GetId()}
+	b.syncRunningCmds.Lock()
+	defer b.syncRunningCmds.Unlock()
+	if _, ok := b.syncRunningCmds.m[k]; !ok {
+		return nil, status.Errorf(codes.NotFound, "no such running command: %q", req.GetId())
+	}
+	if req.GetUnmute() {
+		delete(b.syncRunningCmds.muted, k)
+	} else {
+		b.syncRunningCmds.muted[k] = true
 	}
-	md := fmt.Sprintf("⌚:%s + ⌛:%s%s\n🧑‍💻:%s@%s", ts, ds, rc, req.GetUsername(), req.GetHostname())
-	b.msgs <- fmt.Sprintf("```💲 %s\n\n%s```", cmd.GetCommand(), md)
+	return &pb.MuteCommandResponse{}, nil
 }
 
 func (b *bifrost) CommandEnd(todo context.Context, req *pb.CommandEndRequest) (*pb.CommandEndResponse, error) {
-	go b.commandEndAsync(req)
+	go b.commandEndAsync(req, identityFrom(todo))
 	return &pb.CommandEndResponse{}, nil
 }
 
-func (b *bifrost) ListCommands(todo context.Context, _ *pb.ListCommandsRequest) (*pb.ListCommandsResponse, error) {
+func commandFilter(req *pb.ListCommandsRequest) (func(*pb.Command) bool, error) {
+	var re *regexp.Regexp
+	if req.GetCommandRegex() != "" {
+		var err error
+		if re, err = regexp.Compile(req.GetCommandRegex()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "command_regex: %v", err)
+		}
+	}
+	return func(cmd *pb.Command) bool {
+		switch {
+		case req.GetExcludeId() != "" && cmd.GetId() == req.GetExcludeId():
+		case re != nil && !re.MatchString(cmd.GetCommand()):
+		case req.GetHostname() != "" && cmd.GetHostname() != req.GetHostname():
+		case req.GetUsername() != "" && cmd.GetUsername() != req.GetUsername():
+		case req.GetTty() != "" && cmd.GetTty() != req.GetTty():
+		case req.GetCwd() != "" && cmd.GetCwd() != req.GetCwd():
+		default:
+			return true
+		}
+		return false
+	}, nil
+}
+
+func (b *bifrost) ListCommands(todo context.Context, req *pb.ListCommandsRequest) (*pb.ListCommandsResponse, error) {
+	caller, err := identityFrom(todo).scope(req.GetAllUsers())
+	if err != nil {
+		return nil, err
+	}
+	match, err := commandFilter(req)
+	if err != nil {
+		return nil, err
+	}
 	b.syncRunningCmds.Lock()
-	defer b.syncRunningCmds.Unlock()
-	cmds := []*pb.Command{}
-	for _, cmd := range b.syncRunningCmds.m {
-		cmds = append(cmds, cmd.Command)
+	cmds, users := []*pb.Command{}, []string{}
+	for k, cmd := range b.syncRunningCmds.m {
+		if !caller.sees(k.user) || !match(cmd) {
+			continue
+		}
+		// Clone, so that the fields set below don't stick to the running command.
+		cmds = append(cmds, proto.Clone(cmd).(*pb.Command))
+		users = append(users, k.user)
+	}
+	b.syncRunningCmds.Unlock()
+	names := map[string]bool{}
+	for _, cmd := range cmds {
+		names[cmd.GetCommand()] = true
+	}
+	usual := b.usualRunsOf(names)
+	now := time.Now()
+	for i, cmd := range cmds {
+		if cmd.StartTime != nil {
+			cmd.Elapsed = durationpb.New(now.Sub(cmd.GetStartTime().AsTime()))
+		}
+		if runs := usual[runsKey{users[i], cmd.GetCommand()}]; len(runs) > 0 {
+			cmd.ExpectedDuration = durationpb.New(history.Summarize(runs).P50)
+		}
 	}
 	return &pb.ListCommandsResponse{Commands: cmds}, nil
 }
 
+// result returns the result of the user's finished command with the given id
+// (or nil if there's no such command or it's still running).
+func (b *bifrost) result(user, id string) *pb.CommandResult {
+	b.syncRunningCmds.Lock()
+	r, ok := b.syncRunningCmds.recent[key{user, id}]
+	b.syncRunningCmds.Unlock()
+	if ok {
+		return r
+	}
+	entries := b.history.Entries()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.ID == id && (identity{user: user}).sees(e.Username) {
+			r := &pb.CommandResult{
+				Id:         id,
+				ReturnCode: e.ReturnCode,
+				EndTime:    timestamppb.New(e.EndTime),
+			}
+			if d := e.Duration(); d != 0 {
+				r.Duration = durationpb.New(d)
+			}
+			return r
+		}
+	}
+	return nil
+}
+
+// decide returns the result that decides the wait (see WaitForCommandResponse)
+// out of the results so far (in the order they finished), if any.
+func decide(results []*pb.CommandResult, mode pb.WaitForCommandRequest_Mode, pending int) *pb.CommandResult {
+	if len(results) == 0 {
+		return nil
+	}
+	if mode == pb.WaitForCommandRequest_ANY {
+		return results[0]
+	}
+	if pending > 0 {
+		return nil
+	}
+	for _, r := range results {
+		if r.GetReturnCode() != 0 {
+			return r
+		}
+	}
+	return results[len(results)-1]
+}
+
+func waitIDs(req *pb.WaitForCommandRequest) []string {
+	ids, seen := []string{}, map[string]bool{}
+	for _, id := range append([]string{req.GetId()}, req.GetIds()...) {
+		if id != "" && !seen[id] {
+			ids, seen[id] = append(ids, id), true
+		}
+	}
+	return ids
+}
+
 func (b *bifrost) WaitForCommand(ctx context.Context, req *pb.WaitForCommandRequest) (*pb.WaitForCommandResponse, error) {
+	user := identityFrom(ctx).user
+	ids := waitIDs(req)
+	var match *regexp.Regexp
+	if req.GetMatch() != "" {
+		var err error
+		if match, err = regexp.Compile(req.GetMatch()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "match: %v", err)
+		}
+	}
+	if len(ids) == 0 && match == nil {
+		return nil, status.Error(codes.InvalidArgument, "want: at least one id or match; got: none")
+	}
+	if req.Deadline != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, req.GetDeadline().AsTime())
+		defer cancel()
+	}
+	var (
+		waited = map[string]bool{} // all the commands waited on
+		// The ones that are still running (i.e., yet to have a result).
+		pending = map[string]bool{}
+		results = []*pb.CommandResult{}
+	)
+	// mine reports whether the command (from an event) is the caller's.
+	mine := func(cmd *pb.Command) bool {
+		return user == "" || cmd.GetUsername() == user
+	}
+	matches := func(cmd *pb.Command) bool {
+		return match != nil && cmd.GetId() != req.GetWaiterId() && match.MatchString(cmd.GetCommand())
+	}
+	// subscribe subscribes to the events and (atomically, with the events
+	// published under the same lock) catches up on the running commands.
+	subscribe := func() (<-chan *pb.WatchResponse, func()) {
+		b.syncRunningCmds.Lock()
+		defer b.syncRunningCmds.Unlock()
+		for _, id := range ids {
+			if _, ok := b.syncRunningCmds.m[key{user, id}]; ok {
+				waited[id], pending[id] = true, true
+			}
+		}
+		for k, cmd := range b.syncRunningCmds.m {
+			if k.user == user && matches(cmd) {
+				waited[k.id], pending[k.id] = true, true
+			}
+		}
+		return b.pubsub.subscribe()
+	}
+	events, unsubscribe := subscribe()
+	defer func() {
+		unsubscribe()
+	}()
+	for _, id := range ids {
+		if waited[id] {
+			continue
+		}
+		r := b.result(user, id)
+		if r == nil {
+			return nil, status.Errorf(codes.NotFound, "no such command: %q", id)
+		}
+		waited[id] = true
+		results = append(results, r)
+	}
+	if len(waited) == 0 && !req.GetFuture() {
+		return nil, status.Errorf(codes.NotFound, "no running command matches %q", req.GetMatch())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].GetEndTime().AsTime().Before(results[j].GetEndTime().AsTime())
+	})
+	resp := &pb.WaitForCommandResponse{}
+	for decide(results, req.GetMode(), len(pending)) == nil && !resp.TimedOut {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// Fell behind on the events, so resubscribe and catch up on
+				// whatever finished in the meantime.
+				events, unsubscribe = subscribe()
+				for id := range pending {
+					if r := b.result(user, id); r != nil {
+						delete(pending, id)
+						results = append(results, r)
+					}
+				}
+				continue
+			}
+			if !mine(e.GetCommand()) {
+				continue
+			}
+			id := e.GetCommand().GetId()
+			switch e.GetType() {
+			case pb.WatchResponse_STARTED:
+				if req.GetFuture() && !waited[id] && matches(e.GetCommand()) {
+					waited[id], pending[id] = true, true
+				}
+			case pb.WatchResponse_ENDED:
+				if pending[id] {
+					delete(pending, id)
+					results = append(results, e.GetResult())
+				}
+			}
+		// Block till caller gives up or the wait is decided (see above).
+		case <-ctx.Done():
+			// Only our own deadline is a timeout, the caller giving up isn't.
+			if req.Deadline == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+				time.Now().Before(req.GetDeadline().AsTime()) {
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			resp.TimedOut = true
+		}
+	}
+	resp.Results = results
+	if r := decide(results, req.GetMode(), len(pending)); r != nil {
+		resp.ReturnCode, resp.EndTime, resp.Duration = r.GetReturnCode(), r.GetEndTime(), r.GetDuration()
+	}
+	return resp, nil
+}
+
+func (b *bifrost) Watch(req *pb.WatchRequest, stream pb.Bifrost_WatchServer) error {
+	caller, err := identityFrom(stream.Context()).scope(req.GetAllUsers())
+	if err != nil {
+		return err
+	}
 	b.syncRunningCmds.Lock()
-	var done chan nothing
-	if cmd, ok := b.syncRunningCmds.m[req.GetId()]; ok {
-		done = cmd.done
+	initial := []*pb.WatchResponse{}
+	if req.GetInitial() {
+		for k, cmd := range b.syncRunningCmds.m {
+			if !caller.sees(k.user) {
+				continue
+			}
+			initial = append(initial, &pb.WatchResponse{
+				Type:    pb.WatchResponse_STARTED,
+				Command: cmd,
+				Time:    cmd.GetStartTime(),
+			})
+		}
 	}
+	events, unsubscribe := b.pubsub.subscribe()
 	b.syncRunningCmds.Unlock()
-	if done != nil {
+	defer unsubscribe()
+	sort.Slice(initial, func(i, j int) bool {
+		return initial[i].GetTime().AsTime().Before(initial[j].GetTime().AsTime())
+	})
+	for _, e := range initial {
+		if err := stream.Send(e); err != nil {
+			return err
+		}
+	}
+	for {
 		select {
-		// Block till caller gives up or this command is done running (i.e., next CommandEnd call).
-		case <-done:
-		case <-ctx.Done():
+		case e, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "fell behind on the events")
+			}
+			if !caller.sees(e.GetCommand().GetUsername()) {
+				continue
+			}
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
 		}
 	}
-	return &pb.WaitForCommandResponse{}, nil
 }
 
 func runCommand(cmd exec.Cmd) (*pb.CacheCommandResponse, error) {
@@ -235,9 +676,46 @@ func (b *bifrost) cacheCommandAsync(cmd *exec.Cmd, syncCachedCmd *syncCachedComm
 	}
 }
 
+// runAs makes cmd run as the given user (in their home directory, if there's
+// one, with a minimal environment of theirs), rather than as bifrost's own user.
+func runAs(cmd *exec.Cmd, uid int) error {
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+	}
+	cmd.Dir = "/"
+	if fi, err := os.Stat(u.HomeDir); err == nil && fi.IsDir() {
+		cmd.Dir = u.HomeDir
+	}
+	cmd.Env = []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+		"PATH=" + os.Getenv("PATH"),
+	}
+	return nil
+}
+
 func (b *bifrost) CacheCommand(todo context.Context, req *pb.CacheCommandRequest) (*pb.CacheCommandResponse, error) {
+	caller := identityFrom(todo)
 	cmd := exec.Command(req.GetCommand(), req.GetArgs()...)
-	cmdKey := cmd.String()
+	cmdKey := key{caller.user, cmd.String()}
+	if caller.user != "" && caller.uid != os.Getuid() {
+		// Don't run other users' commands as bifrost's own (likely root) user.
+		if caller.uid == -1 {
+			return nil, status.Errorf(codes.PermissionDenied, "want: a local user to run as; got: %s", caller.user)
+		}
+		if err := runAs(cmd, caller.uid); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to run as %s: %v", caller.user, err)
+		}
+	}
 	b.syncCachedCmds.Lock()
 	syncCachedCmd, ok := b.syncCachedCmds.m[cmdKey]
 	ttl := time.Duration(req.GetWithin()) * time.Second
@@ -261,49 +739,295 @@ func (b *bifrost) CacheCommand(todo context.Context, req *pb.CacheCommandRequest
 	return syncCachedCmd.any, nil
 }
 
+func historyFilter(req *pb.ListHistoryRequest) (func(*history.Entry) bool, error) {
+	var re *regexp.Regexp
+	if req.GetCommandRegex() != "" {
+		var err error
+		if re, err = regexp.Compile(req.GetCommandRegex()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "command_regex: %v", err)
+		}
+	}
+	return func(e *history.Entry) bool {
+		switch {
+		case !strings.Contains(e.Command, req.GetCommand()):
+		case re != nil && !re.MatchString(e.Command):
+		case req.Since != nil && e.StartTime.Before(req.GetSince().AsTime()):
+		case req.Until != nil && e.StartTime.After(req.GetUntil().AsTime()):
+		case req.ReturnCode != nil && e.ReturnCode != req.GetReturnCode():
+		case req.GetHostname() != "" && e.Hostname != req.GetHostname():
+		case req.GetUsername() != "" && e.Username != req.GetUsername():
+		case e.Duration() < req.GetMinDuration().AsDuration():
+		default:
+			return true
+		}
+		return false
+	}, nil
+}
+
+func (b *bifrost) ListHistory(todo context.Context, req *pb.ListHistoryRequest) (*pb.ListHistoryResponse, error) {
+	caller, err := identityFrom(todo).scope(req.GetAllUsers())
+	if err != nil {
+		return nil, err
+	}
+	match, err := historyFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*pb.HistoryEntry{}
+	for _, e := range b.history.Entries() {
+		if !caller.sees(e.Username) || !match(&e) {
+			continue
+		}
+		cmd := &pb.Command{Command: e.Command, Id: e.ID, Cwd: e.Cwd}
+		if !e.StartTime.IsZero() {
+			cmd.StartTime = timestamppb.New(e.StartTime)
+		}
+		entries = append(entries, &pb.HistoryEntry{
+			Command:    cmd,
+			EndTime:    timestamppb.New(e.EndTime),
+			ReturnCode: e.ReturnCode,
+			Username:   e.Username,
+			Hostname:   e.Hostname,
+			Notified:   e.Notified,
+			Reason:     e.Reason,
+		})
+	}
+	if limit := int(req.GetLimit()); limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return &pb.ListHistoryResponse{Entries: entries}, nil
+}
+
+func (b *bifrost) CommandStats(todo context.Context, req *pb.CommandStatsRequest) (*pb.CommandStatsResponse, error) {
+	caller := identityFrom(todo)
+	runs := []history.Entry{}
+	for _, e := range b.history.Entries() {
+		if caller.sees(e.Username) && strings.HasPrefix(e.Command, req.GetPrefix()) {
+			runs = append(runs, e)
+		}
+	}
+	s := history.Summarize(runs)
+	return &pb.CommandStatsResponse{
+		Count:     int32(s.Count),
+		Successes: int32(s.Successes),
+		P50:       durationpb.New(s.P50),
+		P90:       durationpb.New(s.P90),
+		Max:       durationpb.New(s.Max),
+	}, nil
+}
+
 type server struct {
-	addr string
-	b    *bifrost
-	gs   *grpc.Server
+	network, addr string
+	owner         int // uid of the user owning the socket (if network is unix)
+	b             *bifrost
+	gs            *grpc.Server
 }
 
 func (s *server) Addr() string {
-	return s.addr
+	return s.network + ":" + s.addr
+}
+
+// notifyTimeout bounds how long a single notifier gets per event.
+const notifyTimeout = 42 * time.Second
+
+// notifyAll fans out the event to all the notifiers concurrently, so that a
+// slow or failing notifier doesn't delay (or prevent) delivery to the others.
+// Notifiers that don't return within notifyTimeout are reported as failed (and
+// left to finish, or not, on their own).
+func notifyAll(ctx context.Context, ns map[string]Notifier, e *notifiers.Event) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(ns))
+	pending := map[string]bool{}
+	for name, notifier := range ns {
+		pending[name] = true
+		go func(name string, notifier Notifier) {
+			results <- result{name, notifier.Notify(ctx, e)}
+		}(name, notifier)
+	}
+	errs := map[string]error{}
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			delete(pending, r.name)
+			if r.err != nil {
+				errs[r.name] = r.err
+			}
+		case <-ctx.Done():
+			for name := range pending {
+				errs[name] = ctx.Err()
+			}
+			return errs
+		}
+	}
+	return errs
+}
+
+func notifiedEvent(n notification, failed []string) *pb.WatchResponse {
+	return &pb.WatchResponse{
+		Type:            pb.WatchResponse_NOTIFIED,
+		Command:         n.cmd,
+		Time:            timestamppb.Now(),
+		Result:          n.result,
+		Reason:          n.e.Reason,
+		FailedNotifiers: failed,
+	}
 }
 
 func (s *server) notify() {
 	for {
-		msg, ok := <-s.b.msgs
+		n, ok := <-s.b.events
 		if !ok {
 			return
 		}
-		if err := s.b.notifier.Notify(context.TODO(), msg); err != nil {
-			log.Println(err.Error())
-			ergo.Must0(exec.Command("tput", "bel").Run())
+		ns, err := s.b.notifiers(n.user)
+		if err != nil {
+			log.Printf("notifiers of %q: %v", n.user, err)
+			continue
+		}
+		errs := notifyAll(context.TODO(), ns, n.e)
+		failed := []string{}
+		for name, err := range errs {
+			log.Printf("notifier %q: %v", name, err)
+			failed = append(failed, name)
 		}
+		sort.Strings(failed)
+		s.b.pubsub.publish(notifiedEvent(n, failed))
 	}
 }
 
 func (s *server) Start() (err error) {
 	defer ergo.Annotate(&err, "failed to start the server")
-	lis, err := net.Listen("tcp", s.addr)
+	var lis net.Listener
+	if s.network == "unix" {
+		lis, err = listenUnix(s.addr, s.owner, s.b.config.BifrostMultiUser())
+	} else {
+		lis, err = net.Listen(s.network, s.addr)
+	}
 	if err != nil {
 		return err
 	}
 	go s.notify()
-	defer close(s.b.msgs)
+	defer close(s.b.events)
 	return s.gs.Serve(lis)
 }
 
 func (s *server) Stop() {
 	s.gs.GracefulStop()
+	if err := s.b.history.Close(); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// New returns a server that notifies each user (see identity) via the notifiers
+// that ns returns for them.
+func New(c Config, ns func(user string) (map[string]Notifier, error), h *history.Store) *server {
+	b := &bifrost{
+		config:    c,
+		owner:     c.OwnerUID(),
+		notifiers: ns,
+		events:    make(chan notification, 42),
+		history:   h,
+	}
+	b.syncRunningCmds.m = map[key]*pb.Command{}
+	b.syncRunningCmds.recent = map[key]*pb.CommandResult{}
+	b.syncRunningCmds.muted = map[key]bool{}
+	b.syncCachedCmds.m = map[key]*syncCachedCommand{}
+	s := &server{network: c.BifrostNetwork(), owner: b.owner, b: b}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(b.unaryIdentity),
+		grpc.ChainStreamInterceptor(b.streamIdentity),
+	}
+	if s.network == "unix" {
+		s.addr = c.BifrostSocket()
+		// bifrost's own user (which may be root) is let in as well.
+		creds := peerCreds{map[uint32]bool{uint32(s.owner): true, uint32(os.Getuid()): true}}
+		if c.BifrostMultiUser() {
+			// Everyone is let in, each to their own namespace (see identity).
+			creds = peerCreds{}
+		}
+		opts = append(opts, grpc.Creds(creds))
+	} else {
+		s.addr = fmt.Sprintf("localhost:%d", c.BifrostPort())
+	}
+	s.gs = grpc.NewServer(opts...)
+	pb.RegisterBifrostServer(s.gs, b)
+	return s
 }
 
-func New(c Config, notifier Notifier) *server {
-	b := &bifrost{config: c, notifier: notifier, msgs: make(chan string, 42)}
-	b.syncRunningCmds.m = map[string]command{}
-	b.syncCachedCmds.m = map[string]*syncCachedCommand{}
-	gs := grpc.NewServer()
-	pb.RegisterBifrostServer(gs, b)
-	return &server{addr: fmt.Sprintf("localhost:%d", c.BifrostPort()), b: b, gs: gs}
+// CheckSocketDir checks that dir is a directory owned by one of uids that no
+// one else can write to (and so swap the socket in it out from under us, as
+// anyone could in, say, /tmp).
+func CheckSocketDir(dir string, uids ...int) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	owner := -1
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		owner = int(st.Uid)
+	}
+	if fi.IsDir() && fi.Mode().Perm()&0o022 == 0 {
+		for _, uid := range uids {
+			if owner == uid {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: want: directory owned by (and only writable by) one of uids %v; got: %v owned by uid %d",
+		dir, uids, fi.Mode(), owner)
+}
+
+// listenUnix listens on the socket at path, which (along with the directory
+// it's in, if need be) is made accessible to only the given user, or if shared,
+// to everyone (leaving it to peerCreds to tell them apart) while staying owned
+// by bifrost's own user.
+func listenUnix(path string, uid int, shared bool) (net.Listener, error) {
+	dirMode, mode := fs.FileMode(0o700), fs.FileMode(0o600)
+	if shared {
+		// Whoever owns the socket (or its directory) could swap it out from
+		// under everybody else, so that's no one but bifrost's own user.
+		uid, dirMode, mode = os.Getuid(), 0o755, 0o666
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return nil, err
+	}
+	// Only a directory created here is handed over to uid, an existing one (say,
+	// /tmp or /run) has to be fit for the socket as is.
+	if err := os.Mkdir(dir, dirMode); err == nil {
+		// Mkdir is subject to the umask, which may be stricter than dirMode.
+		if err := os.Chmod(dir, dirMode); err != nil {
+			return nil, err
+		}
+		if err := os.Lchown(dir, uid, -1); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrExist) {
+		return nil, err
+	}
+	if err := CheckSocketDir(dir, uid, os.Getuid()); err != nil {
+		return nil, err
+	}
+	// A socket left behind by a previous bifrost would fail the listen below.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	if err := os.Lchown(path, uid, -1); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
 }
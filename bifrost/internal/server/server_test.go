@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/avamsi/heimdall/bifrost/internal/history"
+
+	pb "github.com/avamsi/heimdall/bifrost/proto"
+)
+
+type fakeConfig struct {
+	Config // just the methods below are implemented
+}
+
+func (fakeConfig) OwnerUID() int {
+	return os.Getuid()
+}
+
+func (fakeConfig) BifrostNetwork() string {
+	return "tcp"
+}
+
+func (fakeConfig) BifrostPort() int {
+	return 0
+}
+
+func (fakeConfig) BifrostMultiUser() bool {
+	return false
+}
+
+func newBifrost(t *testing.T) *bifrost {
+	t.Helper()
+	h, err := history.Open(filepath.Join(t.TempDir(), "heimdall.history"), history.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return New(fakeConfig{}, nil, h).b
+}
+
+func start(b *bifrost, user, id, cmd string) {
+	req := &pb.CommandStartRequest{Command: &pb.Command{Command: cmd, StartTime: timestamppb.Now()}}
+	b.commandStart(req, id, user)
+}
+
+func end(b *bifrost, user, id string, code int32) {
+	b.finish(user, &pb.Command{Id: id}, &pb.CommandResult{Id: id, ReturnCode: code, EndTime: timestamppb.Now()})
+}
+
+func result(id string, code int32) *pb.CommandResult {
+	return &pb.CommandResult{Id: id, ReturnCode: code}
+}
+
+func TestDecide(t *testing.T) {
+	var (
+		ok1, ok2     = result("ok1", 0), result("ok2", 0)
+		fail1, fail2 = result("fail1", 1), result("fail2", 2)
+	)
+	tests := []struct {
+		name    string
+		results []*pb.CommandResult
+		mode    pb.WaitForCommandRequest_Mode
+		pending int
+		want    *pb.CommandResult
+	}{
+		{"nothing yet", nil, pb.WaitForCommandRequest_ANY, 2, nil},
+		{"nothing yet (all)", nil, pb.WaitForCommandRequest_ALL, 2, nil},
+		{"any, first", []*pb.CommandResult{fail1, ok1}, pb.WaitForCommandRequest_ANY, 1, fail1},
+		{"any, pending doesn't matter", []*pb.CommandResult{ok1}, pb.WaitForCommandRequest_ANY, 3, ok1},
+		{"all, pending", []*pb.CommandResult{ok1, fail1}, pb.WaitForCommandRequest_ALL, 1, nil},
+		{"all, ok", []*pb.CommandResult{ok1, ok2}, pb.WaitForCommandRequest_ALL, 0, ok2},
+		{"all, first failure", []*pb.CommandResult{ok1, fail2, fail1, ok2}, pb.WaitForCommandRequest_ALL, 0, fail2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := decide(test.results, test.mode, test.pending); got != test.want {
+				t.Errorf("want: %v; got: %v", test.want, got)
+			}
+		})
+	}
+}
+
+// subscribed waits for n subscribers (i.e., waiters) to be subscribed.
+func subscribed(t *testing.T, b *bifrost, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		b.pubsub.mu.Lock()
+		got := len(b.pubsub.subs)
+		b.pubsub.mu.Unlock()
+		if got >= n {
+			return
+		}
+	}
+	t.Fatalf("want: %d subscribers; got: fewer", n)
+}
+
+// fallBehind drops all the subscribers (as publish does to those that fall
+// behind) and ends the user's command with the given id in the meantime, i.e.,
+// before any of them can resubscribe.
+func fallBehind(b *bifrost, user, id string, code int32) {
+	b.syncRunningCmds.Lock()
+	defer b.syncRunningCmds.Unlock()
+	b.pubsub.mu.Lock()
+	for ch := range b.pubsub.subs {
+		delete(b.pubsub.subs, ch)
+		close(ch)
+	}
+	b.pubsub.mu.Unlock()
+	k := key{user, id}
+	b.syncRunningCmds.recent[k] = &pb.CommandResult{Id: id, ReturnCode: code, EndTime: timestamppb.Now()}
+	delete(b.syncRunningCmds.m, k)
+}
+
+func TestWaitForCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		// Commands (by id, running "make <id>") started and ended (with the
+		// given return code) before the wait.
+		running []string
+		ended   map[string]int32
+		req     *pb.WaitForCommandRequest
+		timeout time.Duration // from the start of the wait, if any
+		// What happens while waiting.
+		then         func(t *testing.T, b *bifrost)
+		wantCode     codes.Code
+		wantRC       int32
+		wantResults  int
+		wantTimedOut bool
+	}{
+		{
+			name:        "already ended",
+			ended:       map[string]int32{"1": 3},
+			req:         &pb.WaitForCommandRequest{Id: "1"},
+			wantRC:      3,
+			wantResults: 1,
+		},
+		{
+			name:     "no such command",
+			req:      &pb.WaitForCommandRequest{Id: "1"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "nothing to wait on",
+			req:      &pb.WaitForCommandRequest{},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "bad match",
+			req:      &pb.WaitForCommandRequest{Match: "(make"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:    "any",
+			running: []string{"1", "2"},
+			req:     &pb.WaitForCommandRequest{Ids: []string{"1", "2"}, Mode: pb.WaitForCommandRequest_ANY},
+			then: func(t *testing.T, b *bifrost) {
+				end(b, "", "2", 4)
+			},
+			wantRC:      4,
+			wantResults: 1,
+		},
+		{
+			name:    "all, first failure",
+			running: []string{"1", "2", "3"},
+			req:     &pb.WaitForCommandRequest{Ids: []string{"1", "2", "3"}, Mode: pb.WaitForCommandRequest_ALL},
+			then: func(t *testing.T, b *bifrost) {
+				end(b, "", "3", 0)
+				end(b, "", "1", 2)
+				end(b, "", "2", 1)
+			},
+			wantRC:      2,
+			wantResults: 3,
+		},
+		{
+			name:    "all, some already ended",
+			running: []string{"2"},
+			ended:   map[string]int32{"1": 0},
+			req:     &pb.WaitForCommandRequest{Ids: []string{"1", "2"}, Mode: pb.WaitForCommandRequest_ALL},
+			then: func(t *testing.T, b *bifrost) {
+				end(b, "", "2", 0)
+			},
+			wantResults: 2,
+		},
+		{
+			name:    "timed out",
+			running: []string{"1", "2"},
+			req:     &pb.WaitForCommandRequest{Ids: []string{"1", "2"}, Mode: pb.WaitForCommandRequest_ALL},
+			timeout: 200 * time.Millisecond,
+			then: func(t *testing.T, b *bifrost) {
+				end(b, "", "1", 1)
+			},
+			wantResults:  1,
+			wantTimedOut: true,
+		},
+		{
+			name:    "fell behind",
+			running: []string{"1", "2"},
+			req:     &pb.WaitForCommandRequest{Ids: []string{"1", "2"}, Mode: pb.WaitForCommandRequest_ALL},
+			then: func(t *testing.T, b *bifrost) {
+				fallBehind(b, "", "1", 5)
+				subscribed(t, b, 1)
+				end(b, "", "2", 0)
+			},
+			wantRC:      5,
+			wantResults: 2,
+		},
+		{
+			name:    "someone else's command",
+			user:    "alice",
+			running: []string{"1"},
+			req:     &pb.WaitForCommandRequest{Id: "1"},
+			then: func(t *testing.T, b *bifrost) {
+				start(b, "bob", "1", "make 1")
+				end(b, "bob", "1", 1)
+				end(b, "alice", "1", 0)
+			},
+			wantResults: 1,
+		},
+		{
+			name:    "match",
+			running: []string{"1", "2", "10"},
+			req: &pb.WaitForCommandRequest{
+				Match:    "^make 1",
+				WaiterId: "10",
+				Mode:     pb.WaitForCommandRequest_ALL,
+			},
+			then: func(t *testing.T, b *bifrost) {
+				end(b, "", "1", 6)
+			},
+			wantRC:      6,
+			wantResults: 1,
+		},
+		{
+			name:     "match, nothing running",
+			running:  []string{"2"},
+			req:      &pb.WaitForCommandRequest{Match: "^make 1"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "match, future",
+			req:  &pb.WaitForCommandRequest{Match: "^make 1", Future: true},
+			then: func(t *testing.T, b *bifrost) {
+				start(b, "", "2", "make 2")
+				end(b, "", "2", 1)
+				start(b, "", "1", "make 1")
+				end(b, "", "1", 7)
+			},
+			wantRC:      7,
+			wantResults: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBifrost(t)
+			for _, id := range test.running {
+				start(b, test.user, id, "make "+id)
+			}
+			for id, rc := range test.ended {
+				start(b, test.user, id, "make "+id)
+				end(b, test.user, id, rc)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = context.WithValue(ctx, identityKey{}, identity{user: test.user})
+			type response struct {
+				resp *pb.WaitForCommandResponse
+				err  error
+			}
+			if test.timeout != 0 {
+				test.req.Deadline = timestamppb.New(time.Now().Add(test.timeout))
+			}
+			ch := make(chan response, 1)
+			go func() {
+				resp, err := b.WaitForCommand(ctx, test.req)
+				ch <- response{resp, err}
+			}()
+			if test.then != nil {
+				subscribed(t, b, 1)
+				test.then(t, b)
+			}
+			got := <-ch
+			if code := status.Code(got.err); code != test.wantCode {
+				t.Fatalf("want: %v; got: %v", test.wantCode, got.err)
+			}
+			if got.err != nil {
+				return
+			}
+			if rc := got.resp.GetReturnCode(); rc != test.wantRC {
+				t.Errorf("return code: want: %d; got: %d", test.wantRC, rc)
+			}
+			if n := len(got.resp.GetResults()); n != test.wantResults {
+				t.Errorf("results: want: %d; got: %d", test.wantResults, n)
+			}
+			if timedOut := got.resp.GetTimedOut(); timedOut != test.wantTimedOut {
+				t.Errorf("timed out: want: %v; got: %v", test.wantTimedOut, timedOut)
+			}
+		})
+	}
+}
+
+func TestListCommandsExpectedDuration(t *testing.T) {
+	b := newBifrost(t)
+	t0 := time.Now().Add(-time.Hour)
+	for _, e := range []history.Entry{
+		{Command: "make", StartTime: t0, EndTime: t0.Add(1 * time.Second), Username: "alice"},
+		{Command: "make", StartTime: t0, EndTime: t0.Add(2 * time.Second), Username: "alice"},
+		{Command: "make", StartTime: t0, EndTime: t0.Add(9 * time.Second), Username: "alice", ReturnCode: 1},
+		{Command: "make", StartTime: t0, EndTime: t0.Add(5 * time.Second), Username: "bob"},
+		{Command: "make", StartTime: t0, EndTime: t0.Add(6 * time.Second), Username: "bob"},
+		{Command: "make", StartTime: t0, EndTime: t0.Add(7 * time.Second), Username: "bob"},
+		{Command: "make test", StartTime: t0, EndTime: t0.Add(3 * time.Second), Username: "bob"},
+	} {
+		if err := b.history.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		user, cmd string
+		want      time.Duration // 0 if not expected to be set
+	}{
+		{"alice", "make", 1 * time.Second},
+		{"bob", "make", 6 * time.Second},
+		{"bob", "make test", 3 * time.Second},
+		{"alice", "make test", 0},
+		{"", "make", 5 * time.Second}, // across users
+		{"carol", "make", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.user+"/"+test.cmd, func(t *testing.T) {
+			start(b, test.user, "1", test.cmd)
+			defer end(b, test.user, "1", 0)
+			ctx := context.WithValue(context.Background(), identityKey{}, identity{user: test.user})
+			resp, err := b.ListCommands(ctx, &pb.ListCommandsRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(resp.GetCommands()); n != 1 {
+				t.Fatalf("want: 1 command; got: %d", n)
+			}
+			got := resp.GetCommands()[0].GetExpectedDuration().AsDuration()
+			if got != test.want {
+				t.Errorf("want: %v; got: %v", test.want, got)
+			}
+		})
+	}
+}
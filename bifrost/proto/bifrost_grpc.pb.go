@@ -27,6 +27,10 @@ type BifrostClient interface {
 	ListCommands(ctx context.Context, in *ListCommandsRequest, opts ...grpc.CallOption) (*ListCommandsResponse, error)
 	WaitForCommand(ctx context.Context, in *WaitForCommandRequest, opts ...grpc.CallOption) (*WaitForCommandResponse, error)
 	CacheCommand(ctx context.Context, in *CacheCommandRequest, opts ...grpc.CallOption) (*CacheCommandResponse, error)
+	ListHistory(ctx context.Context, in *ListHistoryRequest, opts ...grpc.CallOption) (*ListHistoryResponse, error)
+	CommandStats(ctx context.Context, in *CommandStatsRequest, opts ...grpc.CallOption) (*CommandStatsResponse, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Bifrost_WatchClient, error)
+	MuteCommand(ctx context.Context, in *MuteCommandRequest, opts ...grpc.CallOption) (*MuteCommandResponse, error)
 }
 
 type bifrostClient struct {
@@ -82,6 +86,65 @@ func (c *bifrostClient) CacheCommand(ctx context.Context, in *CacheCommandReques
 	return out, nil
 }
 
+func (c *bifrostClient) ListHistory(ctx context.Context, in *ListHistoryRequest, opts ...grpc.CallOption) (*ListHistoryResponse, error) {
+	out := new(ListHistoryResponse)
+	err := c.cc.Invoke(ctx, "/Bifrost/ListHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bifrostClient) CommandStats(ctx context.Context, in *CommandStatsRequest, opts ...grpc.CallOption) (*CommandStatsResponse, error) {
+	out := new(CommandStatsResponse)
+	err := c.cc.Invoke(ctx, "/Bifrost/CommandStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bifrostClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Bifrost_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Bifrost_ServiceDesc.Streams[0], "/Bifrost/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &bifrostWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Bifrost_WatchClient interface {
+	Recv() (*WatchResponse, error)
+	grpc.ClientStream
+}
+
+type bifrostWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *bifrostWatchClient) Recv() (*WatchResponse, error) {
+	m := new(WatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *bifrostClient) MuteCommand(ctx context.Context, in *MuteCommandRequest, opts ...grpc.CallOption) (*MuteCommandResponse, error) {
+	out := new(MuteCommandResponse)
+	err := c.cc.Invoke(ctx, "/Bifrost/MuteCommand", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BifrostServer is the server API for Bifrost service.
 // All implementations must embed UnimplementedBifrostServer
 // for forward compatibility
@@ -91,6 +154,10 @@ type BifrostServer interface {
 	ListCommands(context.Context, *ListCommandsRequest) (*ListCommandsResponse, error)
 	WaitForCommand(context.Context, *WaitForCommandRequest) (*WaitForCommandResponse, error)
 	CacheCommand(context.Context, *CacheCommandRequest) (*CacheCommandResponse, error)
+	ListHistory(context.Context, *ListHistoryRequest) (*ListHistoryResponse, error)
+	CommandStats(context.Context, *CommandStatsRequest) (*CommandStatsResponse, error)
+	Watch(*WatchRequest, Bifrost_WatchServer) error
+	MuteCommand(context.Context, *MuteCommandRequest) (*MuteCommandResponse, error)
 	mustEmbedUnimplementedBifrostServer()
 }
 
@@ -113,6 +180,18 @@ func (UnimplementedBifrostServer) WaitForCommand(context.Context, *WaitForComman
 func (UnimplementedBifrostServer) CacheCommand(context.Context, *CacheCommandRequest) (*CacheCommandResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CacheCommand not implemented")
 }
+func (UnimplementedBifrostServer) ListHistory(context.Context, *ListHistoryRequest) (*ListHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListHistory not implemented")
+}
+func (UnimplementedBifrostServer) CommandStats(context.Context, *CommandStatsRequest) (*CommandStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommandStats not implemented")
+}
+func (UnimplementedBifrostServer) Watch(*WatchRequest, Bifrost_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedBifrostServer) MuteCommand(context.Context, *MuteCommandRequest) (*MuteCommandResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MuteCommand not implemented")
+}
 func (UnimplementedBifrostServer) mustEmbedUnimplementedBifrostServer() {}
 
 // UnsafeBifrostServer may be embedded to opt out of forward compatibility for this service.
@@ -216,6 +295,81 @@ func _Bifrost_CacheCommand_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Bifrost_ListHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BifrostServer).ListHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Bifrost/ListHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BifrostServer).ListHistory(ctx, req.(*ListHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bifrost_CommandStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommandStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BifrostServer).CommandStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Bifrost/CommandStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BifrostServer).CommandStats(ctx, req.(*CommandStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bifrost_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BifrostServer).Watch(m, &bifrostWatchServer{stream})
+}
+
+type Bifrost_WatchServer interface {
+	Send(*WatchResponse) error
+	grpc.ServerStream
+}
+
+type bifrostWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *bifrostWatchServer) Send(m *WatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Bifrost_MuteCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MuteCommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BifrostServer).MuteCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Bifrost/MuteCommand",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BifrostServer).MuteCommand(ctx, req.(*MuteCommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Bifrost_ServiceDesc is the grpc.ServiceDesc for Bifrost service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -243,7 +397,25 @@ var Bifrost_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CacheCommand",
 			Handler:    _Bifrost_CacheCommand_Handler,
 		},
+		{
+			MethodName: "ListHistory",
+			Handler:    _Bifrost_ListHistory_Handler,
+		},
+		{
+			MethodName: "CommandStats",
+			Handler:    _Bifrost_CommandStats_Handler,
+		},
+		{
+			MethodName: "MuteCommand",
+			Handler:    _Bifrost_MuteCommand_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Bifrost_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "bifrost/proto/bifrost.proto",
 }
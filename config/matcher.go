@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// matcher matches commands by prefix (the default), glob (with a "glob:" prefix)
+// or RE2 regex (with a "re:" prefix). For example,
+//
+//	make
+//	glob:kubectl * logs -f*
+//	re:^(vi|vim|nvim)\b
+//
+// Globs match the whole command, with * matching any (possibly empty) string
+// (including spaces, slashes and newlines) and ? matching any one character.
+type matcher struct {
+	prefix string
+	re     *regexp.Regexp
+}
+
+func (m matcher) match(cmd string) bool {
+	if m.re != nil {
+		return m.re.MatchString(cmd)
+	}
+	return strings.HasPrefix(cmd, m.prefix)
+}
+
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	// s, so that * matches across the lines of multi-line commands too.
+	b.WriteString("(?s)^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			} else {
+				b.WriteString(`\\`)
+			}
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j == -1 {
+				return nil, fmt.Errorf("unterminated [ in glob %q", glob)
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func parseMatcher(s string) (_ matcher, err error) {
+	switch {
+	case strings.HasPrefix(s, "glob:"):
+		re, err := globToRegexp(strings.TrimPrefix(s, "glob:"))
+		return matcher{re: re}, err
+	case strings.HasPrefix(s, "re:"):
+		re, err := regexp.Compile(strings.TrimPrefix(s, "re:"))
+		return matcher{re: re}, err
+	}
+	return matcher{prefix: s}, nil
+}
+
+func parseMatchers(key string, ss []string) ([]matcher, error) {
+	ms := []matcher{}
+	for i, s := range ss {
+		m, err := parseMatcher(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", key, i, err)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func anyMatch(ms []matcher, cmd string) bool {
+	for _, m := range ms {
+		if m.match(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWord splits s into its first (shell) word and the rest, respecting quotes
+// and backslash escapes (without interpreting them, i.e., the word is returned
+// as is).
+func nextWord(s string) (word, rest string) {
+	s = strings.TrimLeft(s, " \t")
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t':
+			return s[:i], strings.TrimLeft(s[i:], " \t")
+		}
+	}
+	return s, ""
+}
+
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// sudoArgOpts are the sudo options that take an argument (as a separate word).
+var sudoArgOpts = map[string]bool{
+	"-u": true, "-g": true, "-C": true, "-D": true, "-h": true,
+	"-p": true, "-r": true, "-t": true, "-T": true, "-U": true,
+}
+
+// stripWrappers strips leading env assignments and sudo, time and nohup (along
+// with their options) from the command, so that "FOO=1 sudo -u bar make" is
+// matched just like "make".
+func stripWrappers(cmd string) string {
+	for {
+		word, rest := nextWord(cmd)
+		switch {
+		case assignment.MatchString(word), word == "nohup":
+			cmd = rest
+		case word == "time":
+			cmd = rest
+			if word, rest := nextWord(cmd); word == "-p" {
+				cmd = rest
+			}
+		case word == "sudo":
+			cmd = rest
+			for {
+				word, rest := nextWord(cmd)
+				if !strings.HasPrefix(word, "-") {
+					break
+				}
+				cmd = rest
+				if sudoArgOpts[word] {
+					_, cmd = nextWord(cmd)
+				}
+				if word == "--" {
+					break
+				}
+			}
+		default:
+			return strings.TrimLeft(cmd, " \t")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import "testing"
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob, cmd string
+		want      bool
+	}{
+		{"make", "make", true},
+		{"make", "make test", false},
+		{"make*", "make test", true},
+		{"kubectl * logs -f*", "kubectl -n prod logs -f api", true},
+		{"kubectl * logs -f*", "kubectl logs api", false},
+		{"*/bin/*", "/usr/local/bin/go build", true},
+		{"for *", "for i in 1 2\ndo\n  echo $i\ndone", true},
+		{"*done", "for i in 1 2\ndo\n  echo $i\ndone", true},
+		{"vi?", "vim", true},
+		{"vi?", "vi", false},
+		{"vi?", "vi\n", true},
+		{"[nv]vim", "nvim", true},
+		{"[!nv]vim", "nvim", false},
+		{"[!nv]vim", "gvim", true},
+		{"echo \\*", "echo *", true},
+		{"echo \\*", "echo hi", false},
+		{"a.b", "a.b", true},
+		{"a.b", "axb", false},
+		{"(x)+", "(x)+", true},
+	}
+	for _, test := range tests {
+		re, err := globToRegexp(test.glob)
+		if err != nil {
+			t.Fatalf("%q: %v", test.glob, err)
+		}
+		if got := re.MatchString(test.cmd); got != test.want {
+			t.Errorf("%q matches %q: want: %v; got: %v", test.glob, test.cmd, test.want, got)
+		}
+	}
+}
+
+func TestGlobToRegexpErrors(t *testing.T) {
+	for _, glob := range []string{"[abc", "[z-a]"} {
+		if _, err := globToRegexp(glob); err == nil {
+			t.Errorf("%q: want: error; got: nil", glob)
+		}
+	}
+}
+
+func TestParseMatcher(t *testing.T) {
+	tests := []struct {
+		pattern, cmd string
+		want         bool
+	}{
+		{"make", "make test", true},
+		{"make", "cmake", false},
+		{"glob:make", "make test", false},
+		{"glob:*test", "make test", true},
+		{`re:^(vi|vim|nvim)\b`, "nvim foo", true},
+		{`re:^(vi|vim|nvim)\b`, "vimdiff a b", false},
+		{"re:test", "make test", true},
+	}
+	for _, test := range tests {
+		m, err := parseMatcher(test.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", test.pattern, err)
+		}
+		if got := m.match(test.cmd); got != test.want {
+			t.Errorf("%q matches %q: want: %v; got: %v", test.pattern, test.cmd, test.want, got)
+		}
+	}
+}
+
+func TestStripWrappers(t *testing.T) {
+	tests := []struct {
+		cmd, want string
+	}{
+		{"make test", "make test"},
+		{"FOO=1 make", "make"},
+		{"FOO=1 BAR='a b' make", "make"},
+		{`FOO="a \" b" make`, "make"},
+		{"sudo make install", "make install"},
+		{"sudo -u bar -E make", "make"},
+		{"sudo -- make", "make"},
+		{"FOO=1 sudo -u bar make", "make"},
+		{"time -p make", "make"},
+		{"time nohup make", "make"},
+		{"nohup sudo FOO=1 make", "make"},
+		{"  make", "make"},
+		{"sudo", ""},
+		{"./timer", "./timer"},
+		{"FOO = 1", "FOO = 1"},
+	}
+	for _, test := range tests {
+		if got := stripWrappers(test.cmd); got != test.want {
+			t.Errorf("stripWrappers(%q): want: %q; got: %q", test.cmd, test.want, got)
+		}
+	}
+}
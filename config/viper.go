@@ -3,24 +3,167 @@ package config
 import (
 	"errors"
 	"fmt"
-	"net/url"
-	"strings"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sync"
 	"syscall"
+	"text/template"
+	"time"
 	"unicode"
 
 	"github.com/avamsi/ergo"
 	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
+
+	"github.com/avamsi/heimdall/notifiers"
 )
 
+// Never is the (minimum) duration for commands that should never be notified on.
+const Never = time.Duration(math.MaxInt64)
+
+type minDurationRule struct {
+	m matcher
+	d time.Duration
+}
+
 type Config struct {
 	dir string
 	v   *viper.Viper
+
+	mu               sync.Mutex
+	onChanges        []func()
+	notifyTmpl       *template.Template
+	minDuration      time.Duration
+	minDurationRules []minDurationRule
+	alwaysNotify     []matcher
+	neverNotify      []matcher
+	stripWrappers    bool
+	slowFactor       float64
+	historyMaxAge    time.Duration
+}
+
+func parseNotifyTemplate(text string) (_ *template.Template, err error) {
+	defer ergo.Annotate(&err, "failed to parse notify.template")
+	if text == "" {
+		return nil, nil
+	}
+	t, err := notifiers.ParseTemplate("notify", text)
+	if err != nil {
+		return nil, err
+	}
+	// Parsing alone doesn't catch references to fields that don't exist (i.e.,
+	// {{.Cmd}} instead of {{.Command}}), so try it out on an empty event too.
+	return t, t.Execute(io.Discard, &notifiers.Event{})
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "never" {
+		return Never, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (c *Config) parseMinDurations() (_ time.Duration, _ []minDurationRule, err error) {
+	defer ergo.Annotate(&err, "failed to parse min-duration")
+	d := 42 * time.Second
+	if c.v.IsSet("notify.min-duration") {
+		if d, err = parseDuration(c.v.GetString("notify.min-duration")); err != nil {
+			return 0, nil, err
+		}
+	}
+	var raw []struct {
+		Prefix   string
+		Glob     string
+		Regex    string
+		Duration string
+	}
+	if err := c.v.UnmarshalKey("commands.min-duration", &raw); err != nil {
+		return 0, nil, err
+	}
+	rules := []minDurationRule{}
+	for i, r := range raw {
+		var pattern string
+		switch {
+		case r.Prefix != "" && r.Glob == "" && r.Regex == "":
+			pattern = r.Prefix
+		case r.Prefix == "" && r.Glob != "" && r.Regex == "":
+			pattern = "glob:" + r.Glob
+		case r.Prefix == "" && r.Glob == "" && r.Regex != "":
+			pattern = "re:" + r.Regex
+		default:
+			return 0, nil, fmt.Errorf("want: exactly one of prefix, glob or regex; got: %+v", r)
+		}
+		var rule minDurationRule
+		if rule.m, err = parseMatcher(pattern); err != nil {
+			return 0, nil, fmt.Errorf("commands.min-duration[%d]: %w", i, err)
+		}
+		if rule.d, err = parseDuration(r.Duration); err != nil {
+			return 0, nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return d, rules, nil
 }
 
+// validate validates the config and (only if it's valid) caches whatever is
+// derived from it, so that a bad edit doesn't take down a running bifrost.
 func (c *Config) validate() error {
-	return ergo.Error3(c.ChatOptions())
+	cfgs, err := c.Notifiers()
+	if err != nil {
+		return err
+	}
+	if len(cfgs) == 0 {
+		return errors.New("want: at least one notifier under notifiers; got: none")
+	}
+	for name, opts := range cfgs {
+		if typ := notifiers.Type(name, opts); !notifiers.Registered(typ) {
+			return fmt.Errorf("notifier %q: unknown type %q", name, typ)
+		}
+	}
+	notifyTmpl, err := parseNotifyTemplate(c.v.GetString("notify.template"))
+	if err != nil {
+		return err
+	}
+	minDuration, minDurationRules, err := c.parseMinDurations()
+	if err != nil {
+		return err
+	}
+	alwaysNotify, err := parseMatchers(
+		"commands.always-notify", c.v.GetStringSlice("commands.always-notify"))
+	if err != nil {
+		return err
+	}
+	neverNotify, err := parseMatchers(
+		"commands.never-notify", c.v.GetStringSlice("commands.never-notify"))
+	if err != nil {
+		return err
+	}
+	if n := c.v.GetString("bifrost.network"); n != "" && n != "unix" && n != "tcp" {
+		return fmt.Errorf("bifrost.network: want: unix or tcp; got: %q", n)
+	}
+	slowFactor, err := cast.ToFloat64E(c.v.Get("notify.slow-factor"))
+	if err != nil || (slowFactor != 0 && slowFactor <= 1) {
+		return fmt.Errorf("notify.slow-factor: want: 0 (off) or > 1; got: %v", c.v.Get("notify.slow-factor"))
+	}
+	var historyMaxAge time.Duration
+	if c.v.IsSet("history.max-age") {
+		if historyMaxAge, err = time.ParseDuration(c.v.GetString("history.max-age")); err != nil {
+			return fmt.Errorf("failed to parse history.max-age: %w", err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notifyTmpl = notifyTmpl
+	c.historyMaxAge = historyMaxAge
+	c.minDuration, c.minDurationRules = minDuration, minDurationRules
+	c.alwaysNotify, c.neverNotify = alwaysNotify, neverNotify
+	c.stripWrappers = c.v.GetBool("commands.strip-wrappers")
+	c.slowFactor = slowFactor
+	return nil
 }
 
 func (c *Config) createFile() error {
@@ -31,16 +174,31 @@ func (c *Config) createFile() error {
 		return err
 	}
 	c.v.Set("bifrost.port", 54351)
-	c.v.Set("chat.webhook-url", string(url))
+	c.v.Set("notifiers.chat.webhook-url", string(url))
+	c.v.Set("notify.min-duration", "42s")
 	c.v.Set("commands.always-notify", []string{"githubioavamsiheimdallreplaceme"})
 	c.v.Set("commands.never-notify", []string{"githubioavamsiheimdallreplaceme"})
 	return c.v.SafeWriteConfig()
 }
 
-func (c *Config) loadOrCreateFile() (err error) {
+func (c *Config) onChange(fsnotify.Event) {
+	if err := c.validate(); err != nil {
+		log.Printf("ignoring config change: %s\n", err.Error())
+		return
+	}
+	c.mu.Lock()
+	onChanges := c.onChanges
+	c.mu.Unlock()
+	for _, run := range onChanges {
+		run()
+	}
+}
+
+func (c *Config) loadOrCreateFile(create bool) (err error) {
 	defer func() {
 		if err == nil {
 			if err = c.validate(); err == nil {
+				c.v.OnConfigChange(c.onChange)
 				c.v.WatchConfig()
 			}
 		}
@@ -49,31 +207,44 @@ func (c *Config) loadOrCreateFile() (err error) {
 		return nil
 	}
 	cfg404 := viper.ConfigFileNotFoundError{}
-	if !errors.As(err, &cfg404) {
+	if !create || !errors.As(err, &cfg404) {
 		return err
 	}
 	fmt.Printf("%s; Creating anew..\n", cfg404.Error())
 	return c.createFile()
 }
 
-func Load(dir string) (c *Config, err error) {
+func load(dir string, create bool) (c *Config, err error) {
 	defer ergo.Annotate(&err, "failed to load config")
 	v := viper.New()
 	v.SetConfigName("heimdall")
 	v.SetConfigType("yaml")
 	v.AddConfigPath(dir)
-	c = &Config{dir, v}
-	return c, c.loadOrCreateFile()
+	c = &Config{dir: dir, v: v}
+	return c, c.loadOrCreateFile(create)
+}
+
+// Load loads the config from dir, creating it (interactively) if need be.
+func Load(dir string) (*Config, error) {
+	return load(dir, true)
+}
+
+// LoadExisting is like Load, except that it fails instead of creating the
+// config (for when there's no one around to ask, as in bifrost).
+func LoadExisting(dir string) (*Config, error) {
+	return load(dir, false)
 }
 
 func (c *Config) Dir() string {
 	return c.dir
 }
 
+// OnChange registers run to be called whenever the config file changes (and
+// the changed config is valid).
 func (c *Config) OnChange(run func()) {
-	c.v.OnConfigChange(func(fsnotify.Event) {
-		run()
-	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChanges = append(c.onChanges, run)
 }
 
 func (c *Config) EnvAsBool(s string) (bool, error) {
@@ -89,24 +260,194 @@ func (c *Config) BifrostPort() int {
 	return c.v.GetInt("bifrost.port")
 }
 
-func (c *Config) ChatOptions() (apiKey, token, spaceID string, err error) {
-	defer ergo.Annotate(&err, "failed to parse chat webhook URL")
-	raw := c.v.GetString("chat.webhook-url")
-	parsed, err := url.Parse(raw)
-	if err != nil {
-		return "", "", "", err
+// BifrostNetwork returns bifrost.network, which is either unix (the default) or
+// tcp (i.e., localhost:<bifrost.port>, which any local user can connect to).
+func (c *Config) BifrostNetwork() string {
+	if n := c.v.GetString("bifrost.network"); n != "" {
+		return n
+	}
+	return "unix"
+}
+
+// BifrostSocket returns bifrost.socket, which defaults to
+// /tmp/heimdall-<uid>/heimdall.sock, going by the user owning the config
+// (rather than the current user, to keep it the same for bifrost, which may
+// well be run as root, and its clients). A multi-user bifrost defaults to the
+// shared /var/run/heimdall/heimdall.sock instead.
+//
+// The runtime directory of the user (/run/user/<uid>) isn't the default, even
+// where there is one, since it only exists while the user is logged in, while
+// bifrost (as a service) starts at boot and outlives logouts (which would take
+// its socket with them). Set bifrost.socket to it only if bifrost is run per
+// login session.
+//
+// Either way, clients only dial a socket in a directory owned by the owner (or
+// root) that no one else can write to, so that, say, another user can't get to
+// /tmp/heimdall-<uid> first and pose as bifrost.
+func (c *Config) BifrostSocket() string {
+	if s := c.v.GetString("bifrost.socket"); s != "" {
+		return s
+	}
+	if c.BifrostMultiUser() {
+		return "/var/run/heimdall/heimdall.sock"
+	}
+	return fmt.Sprintf("/tmp/heimdall-%d/heimdall.sock", c.OwnerUID())
+}
+
+// BifrostMultiUser reports whether bifrost.multi-user is set, in which case
+// bifrost serves all the users on the machine (rather than just the owner of
+// the config), keeping each of them to their own commands, cache and notifiers.
+func (c *Config) BifrostMultiUser() bool {
+	return c.v.GetBool("bifrost.multi-user")
+}
+
+// BifrostAdmins returns bifrost.admins, the users (besides root and the owner
+// of the config) that can see across users in a multi-user bifrost.
+func (c *Config) BifrostAdmins() []string {
+	return c.v.GetStringSlice("bifrost.admins")
+}
+
+// BifrostTokens returns bifrost.tokens, which maps users to the tokens that
+// identify them over tcp (where there are no peer credentials to go by).
+func (c *Config) BifrostTokens() map[string]string {
+	return c.v.GetStringMapString("bifrost.tokens")
+}
+
+// BifrostToken returns bifrost.token, which identifies the user to bifrost over
+// tcp (see BifrostTokens).
+func (c *Config) BifrostToken() string {
+	return c.v.GetString("bifrost.token")
+}
+
+// OwnerUID returns the uid of the user owning the config directory (or the
+// current user, if that can't be determined).
+func (c *Config) OwnerUID() int {
+	if fi, err := os.Stat(c.dir); err == nil {
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			return int(st.Uid)
+		}
+	}
+	return os.Getuid()
+}
+
+// Notifiers returns the options of all the configured notifier instances, keyed
+// by instance name. For example,
+//
+//	notifiers:
+//	  chat:
+//	    webhook-url: https://chat.googleapis.com/v1/spaces/...
+//	  team-chat:
+//	    type: chat
+//	    webhook-url: https://chat.googleapis.com/v1/spaces/...
+//
+// The (older) top-level chat.webhook-url is read as a notifier named chat.
+func (c *Config) Notifiers() (_ map[string]notifiers.Options, err error) {
+	defer ergo.Annotate(&err, "failed to parse notifiers")
+	cfgs := map[string]notifiers.Options{}
+	for name, raw := range c.v.GetStringMap("notifiers") {
+		// A notifier with no options (i.e., "desktop:") is read as nil.
+		opts, ok := raw.(map[string]any)
+		if !ok && raw != nil {
+			return nil, fmt.Errorf("notifier %q: want: map; got: %T", name, raw)
+		}
+		cfgs[name] = opts
 	}
-	parts := strings.Split(parsed.Path, "/")
-	if parts[1] != "v1" || parts[2] != "spaces" || parts[4] != "messages" {
-		return "", "", "", fmt.Errorf("want: /v1/spaces/{spaceID}/messages; got: %s", parsed.Path)
+	if _, ok := cfgs["chat"]; !ok && c.v.IsSet("chat.webhook-url") {
+		cfgs["chat"] = notifiers.Options{"webhook-url": c.v.GetString("chat.webhook-url")}
 	}
-	return parsed.Query().Get("key"), parsed.Query().Get("token"), parts[3], nil
+	return cfgs, nil
+}
+
+// NotifyTemplate returns the notify.template (as of the last valid config), if
+// any, to render notifications with (instead of the notifier specific default).
+func (c *Config) NotifyTemplate() *template.Template {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.notifyTmpl
 }
 
-func (c *Config) AlwaysNotifyCommands() []string {
-	return c.v.GetStringSlice("commands.always-notify")
+// NotifyMinDuration returns how long the command should've run (without the
+// user interacting with it) to be notified on. For example,
+//
+//	notify:
+//	  min-duration: 42s
+//	commands:
+//	  min-duration:
+//	    - prefix: make test
+//	      duration: 10s
+//	    - glob: kubectl * logs -f*
+//	      duration: never
+//	    - regex: ^(vi|vim|nvim)\b
+//	      duration: never
+//
+// The first matching rule under commands.min-duration wins, falling back to
+// notify.min-duration (which itself defaults to 42s).
+func (c *Config) NotifyMinDuration(cmd string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmd = c.normalize(cmd)
+	for _, rule := range c.minDurationRules {
+		if rule.m.match(cmd) {
+			return rule.d
+		}
+	}
+	return c.minDuration
+}
+
+// normalize strips the wrappers off of the command, if so configured (with
+// commands.strip-wrappers), before it's matched against. Requires c.mu.
+func (c *Config) normalize(cmd string) string {
+	if c.stripWrappers {
+		return stripWrappers(cmd)
+	}
+	return cmd
+}
+
+// NotifySlowFactor returns how many times slower than usual (i.e., than its
+// historical p90) a command should run to be flagged as such in notifications
+// (notify.slow-factor), with 0 (the default) meaning never.
+func (c *Config) NotifySlowFactor() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.slowFactor
+}
+
+// AlwaysNotify reports whether the command matches commands.always-notify, a
+// list of prefixes, globs and regexes (see matcher). For example,
+//
+//	commands:
+//	  always-notify:
+//	    - make
+//	    - glob:kubectl * rollout status*
+//	    - re:^(apt|brew) (install|upgrade)\b
+//	  strip-wrappers: true # i.e., match "sudo apt install .." too
+func (c *Config) AlwaysNotify(cmd string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return anyMatch(c.alwaysNotify, c.normalize(cmd))
+}
+
+// NeverNotify reports whether the command matches commands.never-notify (see
+// AlwaysNotify).
+func (c *Config) NeverNotify(cmd string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return anyMatch(c.neverNotify, c.normalize(cmd))
+}
+
+// HistoryMaxEntries returns how many finished commands to keep in the history
+// (history.max-entries, defaults to 10000), with 0 meaning no limit.
+func (c *Config) HistoryMaxEntries() int {
+	if !c.v.IsSet("history.max-entries") {
+		return 10000
+	}
+	return c.v.GetInt("history.max-entries")
 }
 
-func (c *Config) NeverNotifyCommands() []string {
-	return c.v.GetStringSlice("commands.never-notify")
+// HistoryMaxAge returns how long to keep finished commands in the history for
+// (history.max-age, i.e., 2160h), with 0 (the default) meaning no limit.
+func (c *Config) HistoryMaxAge() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.historyMaxAge
 }
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// loadYAML loads a config from the given YAML (with a notifier thrown in, which
+// is required).
+func loadYAML(t *testing.T, yaml string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	yaml = "notifiers:\n  webhook:\n    url: http://127.0.0.1:1/\n" + yaml
+	if err := os.WriteFile(filepath.Join(dir, "heimdall.yaml"), []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return LoadExisting(dir)
+}
+
+func TestValidateMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"valid", "commands:\n  always-notify: [make, 'glob:kubectl *', 're:^vim?\\b']\n", ""},
+		{"bad glob", "commands:\n  always-notify: [make, 'glob:[abc']\n", "commands.always-notify[1]"},
+		{"bad regex", "commands:\n  never-notify: ['re:(vi']\n", "commands.never-notify[0]"},
+		{"bad min-duration glob", "commands:\n  min-duration:\n    - glob: '[abc'\n      duration: 1s\n", "commands.min-duration[0]"},
+		{"bad min-duration regex", "commands:\n  min-duration:\n    - regex: '(vi'\n      duration: 1s\n", "commands.min-duration[0]"},
+		{"ambiguous min-duration", "commands:\n  min-duration:\n    - prefix: make\n      glob: make*\n      duration: 1s\n", "exactly one of prefix, glob or regex"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadYAML(t, test.yaml)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Errorf("want: no error; got: %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Errorf("want: error with %q; got: %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSlowFactorChange(t *testing.T) {
+	c, err := loadYAML(t, "notify:\n  slow-factor: 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.NotifySlowFactor(); got != 2 {
+		t.Fatalf("want: 2; got: %v", got)
+	}
+	// A bad edit is ignored altogether.
+	c.v.Set("notify.slow-factor", 0.5)
+	c.onChange(fsnotify.Event{})
+	if got := c.NotifySlowFactor(); got != 2 {
+		t.Errorf("want: 2 (kept); got: %v", got)
+	}
+	c.v.Set("notify.slow-factor", 3)
+	c.onChange(fsnotify.Event{})
+	if got := c.NotifySlowFactor(); got != 3 {
+		t.Errorf("want: 3; got: %v", got)
+	}
+}
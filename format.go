@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/avamsi/heimdall/notifiers"
+)
+
+// protoJSON uses the field names as in the proto (i.e., start_time), which is
+// also what --format=template sees (see formatter.print).
+var protoJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+// tsvEscape escapes the characters that'd otherwise break a TSV line apart.
+var tsvEscape = strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// formatter knows how to print a (listing of) M in all the supported formats.
+type formatter[M proto.Message] struct {
+	text      func(M) string // human readable, one line
+	tsvHeader []string
+	tsv       func(M) []string // in the same order as tsvHeader
+}
+
+// print prints the messages in the given format, which is one of
+//
+//	text      human readable, one line per message
+//	json      a JSON array of all the messages
+//	jsonl     one JSON object per line (i.e., JSON lines)
+//	tsv       tab separated values, with a header
+//	template  a Go text/template per message (see tmpl), over its JSON object
+//
+// For example, --format=template --template='{{.id}} {{.start_time}}'.
+func (f formatter[M]) print(format, tmpl string, msgs []M) error {
+	objs := make([]json.RawMessage, len(msgs))
+	if format != "text" && format != "tsv" {
+		for i, m := range msgs {
+			b, err := protoJSON.Marshal(m)
+			if err != nil {
+				return err
+			}
+			objs[i] = b
+		}
+	}
+	switch format {
+	case "text":
+		for _, m := range msgs {
+			fmt.Println(f.text(m))
+		}
+	case "json":
+		b, err := json.MarshalIndent(objs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "jsonl":
+		for _, obj := range objs {
+			// protojson output isn't guaranteed to be stable (or compact), so
+			// compact it to make sure it's on one line.
+			b, err := json.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		}
+	case "tsv":
+		fmt.Println(strings.Join(f.tsvHeader, "\t"))
+		for _, m := range msgs {
+			fields := f.tsv(m)
+			for i := range fields {
+				fields[i] = tsvEscape.Replace(fields[i])
+			}
+			fmt.Println(strings.Join(fields, "\t"))
+		}
+	case "template":
+		if tmpl == "" {
+			return errors.New("--format=template: want: --template; got: none")
+		}
+		t, err := notifiers.ParseTemplate("format", tmpl)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			var data map[string]any
+			if err := json.Unmarshal(obj, &data); err != nil {
+				return err
+			}
+			if err := t.Execute(os.Stdout, data); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+	default:
+		return fmt.Errorf("--format: want: text, json, jsonl, tsv or template; got: %q", format)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+[[ $_github_io_avamsi_heimdall_sourced ]] && return 0
+_github_io_avamsi_heimdall_sourced=true
+
+_github_io_avamsi_heimdall_cmd='_github_io_avamsi_heimdall_nil'
+_github_io_avamsi_heimdall_tty=$(tty 2> /dev/null)
+# Unique across sessions, as long as no two shells share both pid and start time.
+_github_io_avamsi_heimdall_session="${EPOCHSECONDS:-$(date +%s)}-$$"
+# Command ids are generated here (as session.counter), so that starting a
+# command doesn't have to wait on bifrost.
+_github_io_avamsi_heimdall_counter=0
+
+# heimdall relay forwards what's written to its FIFO to bifrost, which saves
+# spawning heimdall (and dialing bifrost) twice per command.
+_github_io_avamsi_heimdall_fifo="${TMPDIR:-/tmp}/heimdall-$UID-$_github_io_avamsi_heimdall_session.fifo"
+if mkfifo -m 600 "$_github_io_avamsi_heimdall_fifo" 2> /dev/null; then
+    heimdall relay --fifo="$_github_io_avamsi_heimdall_fifo" --pid=$$ &> /dev/null &
+    _github_io_avamsi_heimdall_relay=$!
+    disown $_github_io_avamsi_heimdall_relay
+    exec {_github_io_avamsi_heimdall_fd}<> "$_github_io_avamsi_heimdall_fifo"
+fi
+
+# Sends a record (see heimdall relay --help) to relay, if it's still running.
+_github_io_avamsi_heimdall_send() {
+    [[ $_github_io_avamsi_heimdall_relay ]] || return 1
+    kill -0 $_github_io_avamsi_heimdall_relay 2> /dev/null || return 1
+    printf '%s\0' "$@" '' >&$_github_io_avamsi_heimdall_fd
+}
+
+_github_io_avamsi_heimdall_preexec() {
+    _github_io_avamsi_heimdall_cmd=$1
+    _github_io_avamsi_heimdall_preexec_time=${EPOCHSECONDS:-$(date +%s)}
+    # The command may well change the working directory (cd, for example).
+    _github_io_avamsi_heimdall_cwd=$PWD
+    (( _github_io_avamsi_heimdall_counter++ ))
+    _github_io_avamsi_heimdall_id="$_github_io_avamsi_heimdall_session.$_github_io_avamsi_heimdall_counter"
+    local args=(
+        cmd="$_github_io_avamsi_heimdall_cmd"
+        time="$_github_io_avamsi_heimdall_preexec_time"
+        id="$_github_io_avamsi_heimdall_id"
+        cwd="$_github_io_avamsi_heimdall_cwd"
+        tty="$_github_io_avamsi_heimdall_tty"
+        pid=$$
+        shell=bash
+        session="$_github_io_avamsi_heimdall_session"
+    )
+    _github_io_avamsi_heimdall_send start "${args[@]}" ||
+        _github_io_avamsi_heimdall_id=$(heimdall start "${args[@]/#/--}")
+    # Lets the command know its own id (so that, say, heimdall wait --match
+    # doesn't wait on itself).
+    export HEIMDALL_COMMAND_ID=$_github_io_avamsi_heimdall_id
+}
+
+_github_io_avamsi_heimdall_precmd() {
+    local code=$?
+    [[ $_github_io_avamsi_heimdall_cmd == '_github_io_avamsi_heimdall_nil' ]] && return $code
+    unset HEIMDALL_COMMAND_ID
+    local args=(
+        cmd="$_github_io_avamsi_heimdall_cmd"
+        start-time="$_github_io_avamsi_heimdall_preexec_time"
+        code=$code
+        id="$_github_io_avamsi_heimdall_id"
+        cwd="$_github_io_avamsi_heimdall_cwd"
+        tty="$_github_io_avamsi_heimdall_tty"
+        pid=$$
+        shell=bash
+        session="$_github_io_avamsi_heimdall_session"
+    )
+    _github_io_avamsi_heimdall_send end "${args[@]}" force-notify="$HEIMDALL_FORCE_NOTIFY" ||
+        heimdall end "${args[@]/#/--}"
+    # Reset back to nil since it's possible for precmd to be called without preexec (Ctrl-C, for example).
+    _github_io_avamsi_heimdall_cmd='_github_io_avamsi_heimdall_nil'
+    return $code
+}
+
+# Defer to bash-preexec if it's already loaded (it'd clobber the hooks below).
+if [[ $bash_preexec_imported || $__bp_imported ]]; then
+    preexec_functions+=(_github_io_avamsi_heimdall_preexec)
+    precmd_functions+=(_github_io_avamsi_heimdall_precmd)
+    return 0
+fi
+
+# Bash has no preexec, so (like bash-preexec) we make do with a DEBUG trap,
+# which runs before every simple command. _prompt is set to the command number
+# (\#, which only goes up for non-empty command lines) at the very end of
+# PROMPT_COMMAND, so that preexec runs just once per command line, and not for
+# PROMPT_COMMAND itself (which is all that an empty command line runs), no
+# matter what else ends up in it.
+if (( BASH_VERSINFO[0] * 100 + BASH_VERSINFO[1] < 404 )); then
+    echo "heimdall: want: bash 4.4 or later (or bash-preexec); got: $BASH_VERSION" >&2
+    return 1
+fi
+_github_io_avamsi_heimdall_prompt=
+
+_github_io_avamsi_heimdall_at_prompt() {
+    local n='\#'
+    _github_io_avamsi_heimdall_prompt=${n@P}
+}
+
+_github_io_avamsi_heimdall_debug() {
+    [[ $_github_io_avamsi_heimdall_prompt ]] || return
+    # Completion functions also trigger the DEBUG trap.
+    [[ $COMP_LINE ]] && return
+    local n='\#'
+    [[ ${n@P} == "$_github_io_avamsi_heimdall_prompt" ]] && return
+    _github_io_avamsi_heimdall_prompt=
+    # BASH_COMMAND is just the current simple command (i.e., only "make" of
+    # "make && make install"), so prefer the history when it's enabled.
+    local cmd=$BASH_COMMAND
+    if [[ -o history ]]; then
+        local hist
+        hist=$(HISTTIMEFORMAT= builtin history 1)
+        [[ $hist =~ ^\ *[0-9]+\*?\ +(.*)$ ]] && cmd=${BASH_REMATCH[1]}
+    fi
+    _github_io_avamsi_heimdall_preexec "$cmd"
+}
+
+# precmd has to run first to see the return code of the command.
+PROMPT_COMMAND="_github_io_avamsi_heimdall_precmd${PROMPT_COMMAND:+; $PROMPT_COMMAND}; _github_io_avamsi_heimdall_at_prompt"
+trap '_github_io_avamsi_heimdall_debug' DEBUG
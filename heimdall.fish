@@ -0,0 +1,49 @@
+set -g _github_io_avamsi_heimdall_cmd _github_io_avamsi_heimdall_nil
+set -g _github_io_avamsi_heimdall_tty (tty 2> /dev/null)
+# Unique across sessions, as long as no two shells share both pid and start time.
+set -g _github_io_avamsi_heimdall_session (date +%s)-$fish_pid
+# Command ids are generated here (as session.counter), as with zsh and bash.
+# Unlike them though, fish can't keep heimdall relay's FIFO open (or check
+# on it without forking), so it always spawns heimdall.
+set -g _github_io_avamsi_heimdall_counter 0
+
+function _github_io_avamsi_heimdall_preexec --on-event fish_preexec
+    set -g _github_io_avamsi_heimdall_cmd $argv[1]
+    set -g _github_io_avamsi_heimdall_preexec_time (date +%s)
+    # The command may well change the working directory (cd, for example).
+    set -g _github_io_avamsi_heimdall_cwd $PWD
+    set -g _github_io_avamsi_heimdall_counter (math $_github_io_avamsi_heimdall_counter + 1)
+    set -g _github_io_avamsi_heimdall_id (
+        heimdall start \
+            --id="$_github_io_avamsi_heimdall_session.$_github_io_avamsi_heimdall_counter" \
+            --cmd="$_github_io_avamsi_heimdall_cmd" \
+            --time="$_github_io_avamsi_heimdall_preexec_time" \
+            --cwd="$_github_io_avamsi_heimdall_cwd" \
+            --tty="$_github_io_avamsi_heimdall_tty" \
+            --pid=$fish_pid \
+            --shell=fish \
+            --session="$_github_io_avamsi_heimdall_session"
+    )
+    # Lets the command know its own id (so that, say, heimdall wait --match
+    # doesn't wait on itself).
+    set -gx HEIMDALL_COMMAND_ID $_github_io_avamsi_heimdall_id
+end
+
+function _github_io_avamsi_heimdall_postexec --on-event fish_postexec
+    set -l code $status
+    test "$_github_io_avamsi_heimdall_cmd" = _github_io_avamsi_heimdall_nil && return $code
+    set -e HEIMDALL_COMMAND_ID
+    heimdall end \
+        --cmd="$_github_io_avamsi_heimdall_cmd" \
+        --start-time="$_github_io_avamsi_heimdall_preexec_time" \
+        --code=$code \
+        --id="$_github_io_avamsi_heimdall_id" \
+        --cwd="$_github_io_avamsi_heimdall_cwd" \
+        --tty="$_github_io_avamsi_heimdall_tty" \
+        --pid=$fish_pid \
+        --shell=fish \
+        --session="$_github_io_avamsi_heimdall_session"
+    # Reset back to nil since it's possible for postexec to be called without preexec (Ctrl-C, for example).
+    set -g _github_io_avamsi_heimdall_cmd _github_io_avamsi_heimdall_nil
+    return $code
+end
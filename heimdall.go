@@ -2,19 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "embed"
 
 	"github.com/avamsi/ergo"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/djherbis/atime"
-	"github.com/erikgeiser/promptkit/selection"
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/avamsi/heimdall/bifrost"
@@ -26,14 +34,38 @@ import (
 
 type Heimdall struct{}
 
-//go:embed heimdall.sh
-var sh string
+type nothing struct{}
+
+var (
+	//go:embed heimdall.zsh
+	zsh string
+	//go:embed heimdall.bash
+	bash string
+	//go:embed heimdall.fish
+	fish string
+)
+
+type ShOpts struct {
+	// one of zsh, bash or fish (defaults to $SHELL)
+	Shell string
+}
 
 // Sh prints a shell script to be sourced into your favorite shell.
 //
-//	source <(heimdall sh)
-func (Heimdall) Sh() {
-	fmt.Print(sh)
+//	source <(heimdall sh)                # zsh or bash
+//	heimdall sh --shell=fish | source    # fish
+func (Heimdall) Sh(opts ShOpts) error {
+	shell := opts.Shell
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	scripts := map[string]string{"zsh": zsh, "bash": bash, "fish": fish}
+	script, ok := scripts[shell]
+	if !ok {
+		return fmt.Errorf("--shell: want: zsh, bash or fish; got: %q", shell)
+	}
+	fmt.Print(script)
+	return nil
 }
 
 // Config prints the directory heimdall uses to read the config from.
@@ -46,24 +78,52 @@ func (h Heimdall) config() *config.Config {
 }
 
 // Usage: notify [message]
-func (h Heimdall) Notify(args []string) {
-	chat := ergo.Must1(notifiers.NewChat(ergo.Must3(h.config().ChatOptions())))
-	ergo.Must0(chat.Notify(context.Background(), strings.Join(args, " ")))
+func (h Heimdall) Notify(args []string) error {
+	ns := ergo.Must1(notifiers.New(ergo.Must1(h.config().Notifiers())))
+	e := &notifiers.Event{Message: strings.Join(args, " ")}
+	failed := 0
+	for name, n := range ns {
+		if err := n.Notify(context.Background(), e); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to notify on %d of %d notifiers", failed, len(ns))
+	}
+	return nil
 }
 
 type StartOpts struct {
 	Cmd  string
 	Time int64  // seconds from epoch
 	ID   string // (id of the command)
+	// working directory of the command (defaults to that of heimdall start)
+	Cwd     string
+	TTY     string // terminal the command is run from (i.e., $TTY)
+	PID     int64  // pid of the shell the command is run from
+	Shell   string // type of the shell the command is run from (i.e., zsh)
+	Session string // id of the shell session the command is run from
 }
 
-// Starts adds a command to the list of currently running commands.
-func (h Heimdall) Start(opts StartOpts) string {
-	client := ergo.Must1(bifrost.NewClient(h.config()))
+func startRequest(opts StartOpts) *bpb.CommandStartRequest {
+	cwd := opts.Cwd
+	if cwd == "" {
+		// Not being able to get the working directory (say, because it was
+		// deleted) shouldn't get in the way of running the command.
+		cwd, _ = os.Getwd()
+	}
 	req := &bpb.CommandStartRequest{
 		Command: &bpb.Command{
-			Command: opts.Cmd,
-			Id:      opts.ID,
+			Command:   opts.Cmd,
+			Id:        opts.ID,
+			Cwd:       cwd,
+			Username:  ergo.Must1(user.Current()).Username,
+			Hostname:  ergo.Must1(os.Hostname()),
+			Tty:       opts.TTY,
+			Pid:       opts.PID,
+			Shell:     opts.Shell,
+			SessionId: opts.Session,
 		},
 	}
 	if opts.Time != 0 {
@@ -71,7 +131,13 @@ func (h Heimdall) Start(opts StartOpts) string {
 	} else {
 		req.Command.StartTime = timestamppb.Now()
 	}
-	return ergo.Must1(client.CommandStart(context.Background(), req)).GetId()
+	return req
+}
+
+// Starts adds a command to the list of currently running commands.
+func (h Heimdall) Start(opts StartOpts) string {
+	client := ergo.Must1(bifrost.NewClient(h.config()))
+	return ergo.Must1(client.CommandStart(context.Background(), startRequest(opts))).GetId()
 }
 
 type EndOpts struct {
@@ -79,6 +145,11 @@ type EndOpts struct {
 	StartTime int64  // seconds from epoch
 	Code      int32  // return code of the command
 	ID        string // id of the command (from start)
+	Cwd       string // working directory of the command (as in start)
+	TTY       string // terminal the command was run from (as in start)
+	PID       int64  // pid of the shell the command was run from (as in start)
+	Shell     string // type of the shell the command was run from (as in start)
+	Session   string // id of the shell session the command was run from (as in start)
 }
 
 // End removes a command from the list of currently running commands.
@@ -86,79 +157,548 @@ type EndOpts struct {
 // This may also result in a notification to the user if the command was
 // configured to be always notified on or if the start / last interacted with
 // time is outside of the configured duration.
+//
+// The flags shared with start only matter if bifrost didn't see the command
+// start (say, because it was restarted since).
 func (h Heimdall) End(opts EndOpts) error {
 	c := h.config()
 	client := ergo.Must1(bifrost.NewClient(c))
+	req := endRequest(
+		opts,
+		ergo.Must1(c.EnvAsBool("HEIMDALL_FORCE_NOTIFY")),
+		atime.Get(ergo.Must1(os.Stdin.Stat())))
+	return ergo.Error1(client.CommandEnd(context.Background(), req))
+}
+
+func endRequest(opts EndOpts, forceNotify bool, lastInteraction time.Time) *bpb.CommandEndRequest {
 	req := &bpb.CommandEndRequest{
 		Command: &bpb.Command{
-			Command: opts.Cmd,
-			Id:      strings.TrimSpace(opts.ID),
+			Command:   opts.Cmd,
+			Id:        strings.TrimSpace(opts.ID),
+			Cwd:       opts.Cwd,
+			Tty:       opts.TTY,
+			Pid:       opts.PID,
+			Shell:     opts.Shell,
+			SessionId: opts.Session,
 		},
 		ReturnCode:          opts.Code,
-		ForceNotify:         ergo.Must1(c.EnvAsBool("HEIMDALL_FORCE_NOTIFY")),
-		LastInteractionTime: timestamppb.New(atime.Get(ergo.Must1(os.Stdin.Stat()))),
+		ForceNotify:         forceNotify,
+		LastInteractionTime: timestamppb.New(lastInteraction),
 		Username:            ergo.Must1(user.Current()).Username,
 		Hostname:            ergo.Must1(os.Hostname()),
 	}
 	if opts.StartTime != 0 {
 		req.Command.StartTime = &timestamppb.Timestamp{Seconds: opts.StartTime}
 	}
-	return ergo.Error1(client.CommandEnd(context.Background(), req))
+	return req
 }
 
-func (h Heimdall) list(ctx context.Context) []*bpb.Command {
-	// TODO: filter out the current command from this list.
+// list lists the running commands matching req, except for the one calling it
+// (if run from a heimdall aware shell, see heimdall sh).
+func (h Heimdall) list(ctx context.Context, req *bpb.ListCommandsRequest) ([]*bpb.Command, error) {
 	client := ergo.Must1(bifrost.NewClient(h.config()))
-	resp := ergo.Must1(client.ListCommands(ctx, &bpb.ListCommandsRequest{}))
+	req.ExcludeId = os.Getenv("HEIMDALL_COMMAND_ID")
+	resp, err := client.ListCommands(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 	cmds := resp.GetCommands()
 	sort.Slice(cmds, func(i, j int) bool {
 		return cmds[i].GetStartTime().AsTime().Before(cmds[j].GetStartTime().AsTime())
 	})
-	return cmds
+	return cmds, nil
+}
+
+// progress renders how long the command has been running for and, if its usual
+// duration is known, roughly how long it has left (i.e., "1m2s of ~3m, ETA 2m").
+func progress(elapsed, expected time.Duration) string {
+	elapsed = elapsed.Round(time.Second)
+	if expected == 0 {
+		return elapsed.String()
+	}
+	expected = expected.Round(time.Second)
+	if elapsed > expected {
+		return fmt.Sprintf("%s of ~%s, overdue", elapsed, expected)
+	}
+	return fmt.Sprintf("%s of ~%s, ETA %s", elapsed, expected, expected-elapsed)
+}
+
+func cmdProgress(cmd *bpb.Command) string {
+	return progress(cmd.GetElapsed().AsDuration(), cmd.GetExpectedDuration().AsDuration())
+}
+
+type ListOpts struct {
+	Host  string // hostname the command was run on
+	User  string // username the command was run by
+	TTY   string // terminal the command was run from (i.e., /dev/pts/1)
+	Cwd   string // working directory of the command (relative paths are fine)
+	Regex string // RE2 regex to match the command against
+	// output format, one of text, json, jsonl, tsv (with times in RFC 3339 and
+	// durations in seconds) or template
+	Format   string `default:"text"`
+	Template string // Go text/template over the JSON of each command
+	AllUsers bool   // list everyone's commands (admins of a multi-user bifrost)
+}
+
+func rfc3339(t *timestamppb.Timestamp) string {
+	if t == nil {
+		return ""
+	}
+	return t.AsTime().Local().Format(time.RFC3339)
+}
+
+func seconds(d *durationpb.Duration) string {
+	if d == nil {
+		return ""
+	}
+	return strconv.FormatInt(int64(d.AsDuration().Round(time.Second)/time.Second), 10)
 }
 
-// List lists heimdall aware currently running commands.
-func (h Heimdall) List() error {
-	for _, cmd := range h.list(context.Background()) {
+var cmdFormatter = formatter[*bpb.Command]{
+	text: func(cmd *bpb.Command) string {
 		t := cmd.GetStartTime().AsTime().Local()
-		fmt.Printf("[%s: %s] $ %s\n", t.Format(time.Kitchen), cmd.GetId(), cmd.GetCommand())
+		return fmt.Sprintf("[%s: %s] %s$ %s (%s)",
+			t.Format(time.Kitchen), cmd.GetId(), where(cmd), cmd.GetCommand(), cmdProgress(cmd))
+	},
+	tsvHeader: []string{
+		"id", "start_time", "elapsed", "expected_duration", "command", "cwd", "username",
+		"hostname", "tty", "pid", "shell", "session_id",
+	},
+	tsv: func(cmd *bpb.Command) []string {
+		return []string{
+			cmd.GetId(),
+			rfc3339(cmd.GetStartTime()),
+			seconds(cmd.GetElapsed()),
+			seconds(cmd.GetExpectedDuration()),
+			cmd.GetCommand(),
+			cmd.GetCwd(),
+			cmd.GetUsername(),
+			cmd.GetHostname(),
+			cmd.GetTty(),
+			strconv.FormatInt(cmd.GetPid(), 10),
+			cmd.GetShell(),
+			cmd.GetSessionId(),
+		}
+	},
+}
+
+// where renders the working directory of the command like shell prompts tend
+// to (i.e., "~/src/heimdall "), or "" if it's not known.
+func where(cmd *bpb.Command) string {
+	cwd := cmd.GetCwd()
+	if cwd == "" {
+		return ""
 	}
-	return nil
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		if cwd == home || strings.HasPrefix(cwd, home+"/") {
+			cwd = "~" + strings.TrimPrefix(cwd, home)
+		}
+	}
+	return cwd + " "
 }
 
-func (h Heimdall) chooseFromList() (id string, err error) {
-	choices := []*selection.Choice{}
-	for _, cmd := range h.list(context.Background()) {
+// List lists heimdall aware currently running commands. For example,
+//
+//	$ heimdall list --format=template --template='{{.id}} {{.start_time}}'
+func (h Heimdall) List(opts ListOpts) error {
+	req := &bpb.ListCommandsRequest{
+		Hostname:     opts.Host,
+		Username:     opts.User,
+		Tty:          opts.TTY,
+		CommandRegex: opts.Regex,
+		AllUsers:     opts.AllUsers,
+	}
+	if opts.Cwd != "" {
+		cwd, err := filepath.Abs(opts.Cwd)
+		if err != nil {
+			return err
+		}
+		req.Cwd = cwd
+	}
+	cmds, err := h.list(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	return cmdFormatter.print(opts.Format, opts.Template, cmds)
+}
+
+func (h Heimdall) chooseFromList() (ids []string, err error) {
+	cmds, err := h.list(context.Background(), &bpb.ListCommandsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	choices := []string{}
+	for _, cmd := range cmds {
 		t := cmd.GetStartTime().AsTime().Local()
-		s := fmt.Sprintf("[%s] $ %s", t.Format(time.Kitchen), cmd.GetCommand())
-		choices = append(choices, &selection.Choice{String: s, Value: cmd})
+		s := fmt.Sprintf("[%s] %s$ %s (%s)", t.Format(time.Kitchen), where(cmd), cmd.GetCommand(), cmdProgress(cmd))
+		choices = append(choices, s)
 	}
-	s := selection.New("", selection.Choices(choices))
-	s.FilterPlaceholder = ""
-	var c *selection.Choice
-	if c, err = s.RunPrompt(); err == nil {
-		return c.Value.(*bpb.Command).GetId(), nil
+	picks, err := pick(choices)
+	for _, i := range picks {
+		ids = append(ids, cmds[i].GetId())
 	}
-	return "", err
+	return ids, err
 }
 
 type WaitOpts struct {
-	ID string // id of the command (either from start or list)
+	ID []string // ids of the commands (either from start or list)
+	// RE2 regex to (also) wait on the running commands matching it
+	Match string
+	// with match, also wait on (or, if none are running, for) matching commands
+	// that start later
+	Future bool
+	// wait till any one of the commands is done (instead of all of them)
+	Any     bool
+	Timeout string // give up after this long (i.e., 10m) and exit 124
+}
+
+// exitTimedOut is what wait exits with on timing out (as with timeout(1)).
+const exitTimedOut = 124
+
+// waitExitCode summarizes a wait as an exit code, i.e., the code of the result
+// that decided it (see WaitForCommandResponse), or exitTimedOut if it timed out
+// before anything decided it.
+func waitExitCode(resp *bpb.WaitForCommandResponse) int {
+	if resp.GetTimedOut() && resp.EndTime == nil {
+		return exitTimedOut
+	}
+	return int(resp.GetReturnCode())
 }
 
-// Wait waits on a heimdall aware command till it's done running and exits 0.
+// Wait waits on heimdall aware commands till they're done running (all of them,
+// or any one of them with --any) and exits with the return code of the first
+// one to fail (the first one done, with --any; or 124 on timeout), so that,
+// for example, wait && deploy only deploys if the build succeeded. Commands
+// that are already done work too.
+//
+// Without any ids (or match), wait lets you pick the commands from the running
+// ones. With match, wait needs no TTY, which makes it handy in scripts --
+//
+//	$ heimdall wait --match='terraform apply' --future && notify-team
 func (h Heimdall) Wait(opts WaitOpts) {
-	if opts.ID == "" {
+	if len(opts.ID) == 0 && opts.Match == "" {
 		var err error
 		if opts.ID, err = h.chooseFromList(); err != nil {
-			// TODO: should we log something here?
-			return
+			// Nothing was waited on, which mustn't pass for success (as in
+			// wait && deploy).
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	req := &bpb.WaitForCommandRequest{
+		Match:  opts.Match,
+		Future: opts.Future,
+		// So that wait --match doesn't end up matching (and waiting on) itself.
+		WaiterId: os.Getenv("HEIMDALL_COMMAND_ID"),
+	}
+	for _, id := range opts.ID {
+		req.Ids = append(req.Ids, strings.TrimSpace(id))
+	}
+	if opts.Any {
+		req.Mode = bpb.WaitForCommandRequest_ANY
+	}
+	if opts.Timeout != "" {
+		d, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--timeout: %v\n", err)
+			os.Exit(1)
 		}
+		req.Deadline = timestamppb.New(time.Now().Add(d))
 	}
 	client := ergo.Must1(bifrost.NewClient(h.config()))
-	ergo.Must1(client.WaitForCommand(context.Background(), &bpb.WaitForCommandRequest{
-		Id: strings.TrimSpace(opts.ID),
-	}))
+	stop := func() {}
+	if len(req.Ids) == 1 {
+		stop = showProgress(client, req.Ids[0])
+	}
+	resp, err := client.WaitForCommand(context.Background(), req)
+	stop()
+	if status.Code(err) == codes.NotFound {
+		fmt.Fprintln(os.Stderr, status.Convert(err).Message())
+		os.Exit(1)
+	}
+	ergo.Must0(err)
+	os.Exit(waitExitCode(resp))
+}
+
+// showProgress keeps a live progress line (see progress) of the command on
+// stderr (only if it's a terminal) till the returned stop is called.
+func showProgress(client bpb.BifrostClient, id string) (stop func()) {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+	resp, err := client.ListCommands(context.Background(), &bpb.ListCommandsRequest{})
+	if err != nil {
+		return func() {}
+	}
+	var cmd *bpb.Command
+	for _, c := range resp.GetCommands() {
+		if c.GetId() == id {
+			cmd = c
+		}
+	}
+	if cmd == nil || cmd.StartTime == nil {
+		return func() {}
+	}
+	var (
+		start    = cmd.GetStartTime().AsTime()
+		expected = cmd.GetExpectedDuration().AsDuration()
+		done     = make(chan nothing)
+		stopped  = make(chan nothing)
+	)
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			// \r and \033[K rewrite the line in place (clearing what's left).
+			fmt.Fprintf(os.Stderr, "\r\033[K⌛ %s", progress(time.Since(start), expected))
+			select {
+			case <-ticker.C:
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+type HistoryOpts struct {
+	Cmd   string // substring of the command
+	Regex string // RE2 regex to match the command against
+	// start time lower bound, either a duration ago (i.e., 24h) or a date /
+	// time (i.e., 2022-09-13 or 2022-09-13T15:04:05+05:30)
+	Since       string
+	Until       string // start time upper bound (see since)
+	Code        int64  `default:"-1"` // return code of the command (-1 is any)
+	Host        string // hostname the command ran on
+	User        string // username the command ran as
+	MinDuration string // minimum duration of the command (i.e., 5m)
+	Limit       int64  // only show the most recent limit commands (if set)
+	// output format, one of text, json, jsonl, tsv (with times in RFC 3339 and
+	// durations in seconds) or template
+	Format   string `default:"text"`
+	Template string // Go text/template over the JSON of each entry
+	AllUsers bool   // list everyone's history (admins of a multi-user bifrost)
+}
+
+func parseTimeFlag(name, s string) (*timestamppb.Timestamp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return timestamppb.New(time.Now().Add(-d)), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return timestamppb.New(t), nil
+		}
+	}
+	return nil, fmt.Errorf("--%s: want: duration (i.e., 24h) or date / time; got: %q", name, s)
+}
+
+func (opts HistoryOpts) request() (_ *bpb.ListHistoryRequest, err error) {
+	req := &bpb.ListHistoryRequest{
+		Command:      opts.Cmd,
+		CommandRegex: opts.Regex,
+		Hostname:     opts.Host,
+		Username:     opts.User,
+		Limit:        int32(opts.Limit),
+		AllUsers:     opts.AllUsers,
+	}
+	if req.Since, err = parseTimeFlag("since", opts.Since); err != nil {
+		return nil, err
+	}
+	if req.Until, err = parseTimeFlag("until", opts.Until); err != nil {
+		return nil, err
+	}
+	if opts.Code != -1 {
+		code := int32(opts.Code)
+		req.ReturnCode = &code
+	}
+	if opts.MinDuration != "" {
+		d, err := time.ParseDuration(opts.MinDuration)
+		if err != nil {
+			return nil, fmt.Errorf("--min-duration: %w", err)
+		}
+		req.MinDuration = durationpb.New(d)
+	}
+	return req, nil
+}
+
+// History lists finished commands (oldest first), optionally filtered by the
+// flags. For example, to find the last failing go test run,
+//
+//	$ heimdall history --cmd='go test' --code=1 --limit=1
+func (h Heimdall) History(opts HistoryOpts) error {
+	req, err := opts.request()
+	if err != nil {
+		return err
+	}
+	client := ergo.Must1(bifrost.NewClient(h.config()))
+	resp, err := client.ListHistory(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	return historyFormatter.print(opts.Format, opts.Template, resp.GetEntries())
+}
+
+var historyFormatter = formatter[*bpb.HistoryEntry]{
+	text: func(e *bpb.HistoryEntry) string {
+		cmd := e.GetCommand()
+		t := cmd.GetStartTime().AsTime().Local()
+		if cmd.StartTime == nil {
+			t = e.GetEndTime().AsTime().Local()
+		}
+		// Unlike List, history goes back further than today.
+		layout, now := time.Kitchen, time.Now()
+		if y, m, d := t.Date(); y != now.Year() || m != now.Month() || d != now.Day() {
+			layout = "Jan _2 " + time.Kitchen
+		}
+		return fmt.Sprintf("[%s: %s] $ %s", t.Format(layout), cmd.GetId(), cmd.GetCommand())
+	},
+	tsvHeader: []string{
+		"id", "start_time", "end_time", "duration", "return_code", "command", "cwd",
+		"username", "hostname", "notified", "reason",
+	},
+	tsv: func(e *bpb.HistoryEntry) []string {
+		cmd, duration := e.GetCommand(), ""
+		if cmd.StartTime != nil {
+			d := e.GetEndTime().AsTime().Sub(cmd.GetStartTime().AsTime())
+			duration = seconds(durationpb.New(d))
+		}
+		return []string{
+			cmd.GetId(),
+			rfc3339(cmd.GetStartTime()),
+			rfc3339(e.GetEndTime()),
+			duration,
+			strconv.Itoa(int(e.GetReturnCode())),
+			cmd.GetCommand(),
+			cmd.GetCwd(),
+			e.GetUsername(),
+			e.GetHostname(),
+			strconv.FormatBool(e.GetNotified()),
+			e.GetReason(),
+		}
+	},
+}
+
+// Stats prints the number of runs, success rate and duration percentiles of the
+// finished commands that start with the given prefix. For example,
+//
+//	$ heimdall stats make build
+//	runs: 42 (95% ok)
+//	p50: 1m3s, p90: 1m42s, max: 4m2s
+//
+// Short: Stats prints duration stats of a command
+// Usage: stats prefix
+func (h Heimdall) Stats(args []string) error {
+	client := ergo.Must1(bifrost.NewClient(h.config()))
+	resp, err := client.CommandStats(context.Background(), &bpb.CommandStatsRequest{
+		Prefix: strings.Join(args, " "),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.GetCount() == 0 {
+		return errors.New("no finished commands with the given prefix")
+	}
+	ok := 100 * float64(resp.GetSuccesses()) / float64(resp.GetCount())
+	fmt.Printf("runs: %d (%.0f%% ok)\n", resp.GetCount(), ok)
+	round := func(d *durationpb.Duration) time.Duration {
+		return d.AsDuration().Round(time.Second)
+	}
+	fmt.Printf("p50: %s, p90: %s, max: %s\n",
+		round(resp.GetP50()), round(resp.GetP90()), round(resp.GetMax()))
+	return nil
+}
+
+type WatchOpts struct {
+	JSON     bool // print the events as JSON lines (instead of text)
+	AllUsers bool // watch everyone's commands (admins of a multi-user bifrost)
+}
+
+func watchLine(e *bpb.WatchResponse) string {
+	cmd, r := e.GetCommand(), e.GetResult()
+	t := e.GetTime().AsTime().Local().Format(time.Kitchen)
+	what := strings.ToLower(e.GetType().String())
+	switch e.GetType() {
+	case bpb.WatchResponse_ENDED:
+		what = fmt.Sprintf("ended (%s", notifiers.ExitStatus(r.GetReturnCode()))
+		if r.Duration != nil {
+			what += ", took " + r.GetDuration().AsDuration().Round(time.Second).String()
+		}
+		what += ")"
+	case bpb.WatchResponse_NOTIFIED:
+		what = fmt.Sprintf("notified (%s)", e.GetReason())
+		if len(e.GetFailedNotifiers()) > 0 {
+			what += fmt.Sprintf(" [failed: %s]", strings.Join(e.GetFailedNotifiers(), ", "))
+		}
+	}
+	return fmt.Sprintf("[%s: %s] %s $ %s", t, cmd.GetId(), what, cmd.GetCommand())
+}
+
+// Watch prints the lifecycle events (started, ended and notified) of heimdall
+// aware commands as they happen, starting with the already running ones.
+func (h Heimdall) Watch(opts WatchOpts) error {
+	client := ergo.Must1(bifrost.NewClient(h.config()))
+	stream, err := client.Watch(context.Background(), &bpb.WatchRequest{Initial: true, AllUsers: opts.AllUsers})
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if opts.JSON {
+			fmt.Println(string(ergo.Must1(protojson.Marshal(e))))
+		} else {
+			fmt.Println(watchLine(e))
+		}
+	}
+}
+
+// Top shows a (full-screen) dashboard of the running and recently finished
+// commands, updated live. The selected command can be waited on (w), muted (m,
+// i.e., not notified on) or have its id copied (c).
+func (h Heimdall) Top() error {
+	client := ergo.Must1(bifrost.NewClient(h.config()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &bpb.WatchRequest{Initial: true})
+	if err != nil {
+		return err
+	}
+	t := &top{client: client, stream: stream, running: map[string]*bpb.Command{}, muted: map[string]bool{}}
+	// Seed the recently finished commands from the history (Watch only has
+	// what happens from now on).
+	resp, err := client.ListHistory(ctx, &bpb.ListHistoryRequest{Limit: topRecent})
+	if err != nil {
+		return err
+	}
+	for _, e := range resp.GetEntries() {
+		r := &bpb.CommandResult{Id: e.GetCommand().GetId(), ReturnCode: e.GetReturnCode(), EndTime: e.GetEndTime()}
+		if e.GetCommand().StartTime != nil {
+			d := e.GetEndTime().AsTime().Sub(e.GetCommand().GetStartTime().AsTime())
+			r.Duration = durationpb.New(d)
+		}
+		t.observe(&bpb.WatchResponse{Type: bpb.WatchResponse_ENDED, Command: e.GetCommand(), Result: r})
+	}
+	if err := tea.NewProgram(t, tea.WithAltScreen()).Start(); err != nil {
+		return err
+	}
+	if t.err != nil {
+		return t.err
+	}
+	if t.waitID != "" {
+		cancel()
+		h.Wait(WaitOpts{ID: []string{t.waitID}})
+	}
+	return nil
 }
 
 type CacheOpts struct {
@@ -166,6 +706,38 @@ type CacheOpts struct {
 	Within int32 `default:"420"`
 	// returns failed runs (only successful runs are returned by default)
 	Any bool `default:"false"`
+	// also print when the returned run finished and its age to stderr, either as
+	// text or json (nothing is printed by default)
+	Meta string
+}
+
+func checkCacheMeta(format string) error {
+	switch format {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("--meta: want: text or json; got: %q", format)
+}
+
+// cacheMeta prints the metadata of the returned (cached or otherwise) run, in
+// the given format (see checkCacheMeta).
+func cacheMeta(format string, resp *bpb.CacheCommandResponse) error {
+	t := resp.GetReturnTime().AsTime()
+	age := time.Since(t).Round(time.Second)
+	switch format {
+	case "text":
+		fmt.Fprintf(os.Stderr, "heimdall: ran at %s (%s ago)\n", t.Local().Format(time.RFC3339), age)
+	case "json":
+		b, err := json.Marshal(map[string]any{
+			"return_time": t.Local().Format(time.RFC3339),
+			"age":         age.Seconds(),
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, string(b))
+	}
+	return nil
 }
 
 // Cache pass-through executes the command (i.e., command is run iff a cached
@@ -187,6 +759,11 @@ func (h Heimdall) Cache(opts CacheOpts, args []string) {
 		fmt.Fprintln(os.Stderr, "please pass a command to be run, see --help")
 		os.Exit(1)
 	}
+	// Before running the command, rather than failing after the fact.
+	if err := checkCacheMeta(opts.Meta); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	client := ergo.Must1(bifrost.NewClient(h.config()))
 	resp := ergo.Must1(client.CacheCommand(context.Background(), &bpb.CacheCommandRequest{
 		Command: args[0],
@@ -196,5 +773,6 @@ func (h Heimdall) Cache(opts CacheOpts, args []string) {
 	}))
 	fmt.Print(resp.GetStdout())
 	fmt.Fprint(os.Stderr, resp.GetStderr())
+	ergo.Must0(cacheMeta(opts.Meta, resp))
 	os.Exit(int(resp.ReturnCode))
 }
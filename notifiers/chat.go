@@ -3,6 +3,9 @@ package notifiers
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/avamsi/ergo"
 	"google.golang.org/api/chat/v1"
@@ -10,15 +13,41 @@ import (
 	"google.golang.org/api/option"
 )
 
+func init() {
+	Register("chat", func(opts Options) (Notifier, error) {
+		apiKey, token, spaceID, err := parseChatWebhookURL(opts.String("webhook-url"))
+		if err != nil {
+			return nil, err
+		}
+		return NewChat(apiKey, token, spaceID)
+	})
+}
+
 type Chat struct {
 	service *chat.Service
 	token   googleapi.CallOption
 	spaceID string
 }
 
-func (c *Chat) Notify(ctx context.Context, msg string) (err error) {
+func chatText(e *Event) string {
+	if e.Message != "" {
+		return e.Message
+	}
+	ts := e.StartTime.Local().Format(time.Kitchen)
+	rc := ""
+	if e.ReturnCode != 0 {
+		rc = fmt.Sprintf(" -> 🙅:%d", e.ReturnCode)
+	}
+	md := fmt.Sprintf("⌚:%s + ⌛:%s%s\n🧑‍💻:%s@%s", ts, e.Duration, rc, e.Username, e.Hostname)
+	if e.SlowerBy != 0 {
+		md += "\n" + e.Slow()
+	}
+	return fmt.Sprintf("```💲 %s\n\n%s```", e.Command, md)
+}
+
+func (c *Chat) Notify(ctx context.Context, e *Event) (err error) {
 	defer ergo.Annotate(&err, "failed to notify on chat")
-	call := c.service.Spaces.Messages.Create("spaces/"+c.spaceID, &chat.Message{Text: msg})
+	call := c.service.Spaces.Messages.Create("spaces/"+c.spaceID, &chat.Message{Text: chatText(e)})
 	return ergo.Error1(call.Context(ctx).Do(c.token))
 }
 
@@ -30,6 +59,19 @@ func (s *simpleCallOption) Get() (string, string) {
 	return s.key, s.value
 }
 
+func parseChatWebhookURL(raw string) (apiKey, token, spaceID string, err error) {
+	defer ergo.Annotate(&err, "failed to parse chat webhook URL")
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", "", "", err
+	}
+	parts := strings.Split(parsed.Path, "/")
+	if len(parts) != 5 || parts[1] != "v1" || parts[2] != "spaces" || parts[4] != "messages" {
+		return "", "", "", fmt.Errorf("want: /v1/spaces/{spaceID}/messages; got: %s", parsed.Path)
+	}
+	return parsed.Query().Get("key"), parsed.Query().Get("token"), parts[3], nil
+}
+
 func NewChat(apiKey, token, spaceID string) (c *Chat, err error) {
 	s, err := chat.NewService(context.TODO(), option.WithAPIKey(apiKey))
 	if err != nil {
@@ -0,0 +1,183 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os/exec"
+	"sync"
+
+	"github.com/avamsi/ergo"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsName  = "org.freedesktop.Notifications"
+	notificationsPath  = dbus.ObjectPath("/org/freedesktop/Notifications")
+	notificationsIface = notificationsName
+)
+
+// Urgency levels, as defined by the Desktop Notifications Specification.
+const (
+	urgencyLow byte = iota
+	urgencyNormal
+	urgencyCritical
+)
+
+func init() {
+	Register("desktop", func(opts Options) (Notifier, error) {
+		return NewDesktop(opts.String("address"), opts.String("focus-command")), nil
+	})
+	// focus-command is run on clicks that come over the bus at address, which
+	// may well be one of the config's choosing.
+	Privileged("desktop", "address", "focus-command")
+}
+
+// Desktop sends notifications over D-Bus, as per the Desktop Notifications
+// Specification (i.e., org.freedesktop.Notifications).
+type Desktop struct {
+	address  string // of the (session) bus; empty for $DBUS_SESSION_BUS_ADDRESS
+	focusCmd string // run (with sh -c) when a notification is clicked on
+
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	closed  bool
+	actions bool            // whether the notification server supports actions
+	pending map[uint32]bool // notifications (IDs) waiting on a click
+}
+
+func (d *Desktop) handleSignals(ch chan *dbus.Signal) {
+	for sig := range ch {
+		switch sig.Name {
+		case notificationsIface + ".ActionInvoked":
+			var (
+				id     uint32
+				action string
+			)
+			if dbus.Store(sig.Body, &id, &action) != nil || action != "default" {
+				continue
+			}
+			d.mu.Lock()
+			ok := d.pending[id]
+			delete(d.pending, id)
+			d.mu.Unlock()
+			if ok {
+				if err := exec.Command("sh", "-c", d.focusCmd).Run(); err != nil {
+					log.Println(err.Error())
+				}
+			}
+		case notificationsIface + ".NotificationClosed":
+			var id uint32
+			if len(sig.Body) > 0 && dbus.Store(sig.Body[:1], &id) == nil {
+				d.mu.Lock()
+				delete(d.pending, id)
+				d.mu.Unlock()
+			}
+		}
+	}
+}
+
+// connect (re)connects to the bus lazily, so that the desktop notifier can be
+// created (and the config validated) even when there's no bus to talk to yet.
+// Callers must hold d.mu.
+func (d *Desktop) connect(ctx context.Context) (_ *dbus.Conn, err error) {
+	if d.closed {
+		return nil, errors.New("want: open desktop notifier; got: closed")
+	}
+	if d.conn != nil && d.conn.Connected() {
+		return d.conn, nil
+	}
+	var conn *dbus.Conn
+	if d.address != "" {
+		conn, err = dbus.Connect(d.address, dbus.WithContext(ctx))
+	} else {
+		conn, err = dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var caps []string
+	obj := conn.Object(notificationsName, notificationsPath)
+	if err := obj.CallWithContext(ctx, notificationsIface+".GetCapabilities", 0).Store(&caps); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	d.actions = false
+	for _, c := range caps {
+		if c == "actions" {
+			d.actions = true
+		}
+	}
+	if d.actions && d.focusCmd != "" {
+		err := conn.AddMatchSignalContext(ctx,
+			dbus.WithMatchObjectPath(notificationsPath),
+			dbus.WithMatchInterface(notificationsIface))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		ch := make(chan *dbus.Signal, 42)
+		conn.Signal(ch)
+		go d.handleSignals(ch)
+	}
+	d.conn = conn
+	return conn, nil
+}
+
+func (d *Desktop) send(ctx context.Context, summary, body string, code int32) (err error) {
+	defer ergo.Annotate(&err, "failed to notify on desktop")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conn, err := d.connect(ctx)
+	if err != nil {
+		return err
+	}
+	urgency := urgencyNormal
+	if code != 0 {
+		urgency = urgencyCritical
+	}
+	hints := map[string]dbus.Variant{
+		"urgency":       dbus.MakeVariant(urgency),
+		"desktop-entry": dbus.MakeVariant("heimdall"),
+	}
+	actions := []string{}
+	if d.actions && d.focusCmd != "" {
+		// "default" is the action invoked when the notification is clicked on.
+		actions = append(actions, "default", "Focus")
+	}
+	var id uint32
+	obj := conn.Object(notificationsName, notificationsPath)
+	call := obj.CallWithContext(ctx, notificationsIface+".Notify", 0,
+		"heimdall", uint32(0), "utilities-terminal", summary, body, actions, hints, int32(-1))
+	if err := call.Store(&id); err != nil {
+		return err
+	}
+	if len(actions) > 0 {
+		d.pending[id] = true
+	}
+	return nil
+}
+
+func (d *Desktop) Notify(ctx context.Context, e *Event) error {
+	return d.send(ctx, e.Title(), e.Body(), e.ReturnCode)
+}
+
+// Close disconnects from the bus (which also stops listening for clicks on the
+// notifications sent so far), after which the notifier can no longer be used.
+func (d *Desktop) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if d.conn == nil {
+		return nil
+	}
+	err := d.conn.Close()
+	d.conn = nil
+	return err
+}
+
+// NewDesktop creates a new desktop notifier that talks to the notification
+// server on the bus at the given address (or the session bus, if empty).
+func NewDesktop(address, focusCmd string) *Desktop {
+	return &Desktop{address: address, focusCmd: focusCmd, pending: map[uint32]bool{}}
+}
@@ -0,0 +1,182 @@
+package notifiers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// privateBus starts a dbus-daemon of its own (skipping the test if there's none
+// installed) and returns its address.
+func privateBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip(err)
+	}
+	// Not t.TempDir, which can be too long a path for a Unix socket.
+	dir, err := os.MkdirTemp("", "heimdall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	conf := fmt.Sprintf(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-BUS Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <policy context="default">
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`, filepath.Join(dir, "bus"))
+	if err := os.WriteFile(filepath.Join(dir, "bus.conf"), []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("dbus-daemon", "--nofork", "--print-address", "--config-file="+filepath.Join(dir, "bus.conf"))
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(addr)
+}
+
+// notification is what fakeNotifications was asked to show.
+type notification struct {
+	summary, body string
+	actions       []string
+	urgency       byte
+}
+
+// fakeNotifications is a bare-bones org.freedesktop.Notifications server.
+type fakeNotifications struct {
+	caps []string
+	ch   chan notification
+}
+
+func (f *fakeNotifications) GetCapabilities() ([]string, *dbus.Error) {
+	return f.caps, nil
+}
+
+func (f *fakeNotifications) Notify(_ string, _ uint32, _, summary, body string, actions []string, hints map[string]dbus.Variant, _ int32) (uint32, *dbus.Error) {
+	var urgency byte
+	hints["urgency"].Store(&urgency)
+	f.ch <- notification{summary, body, actions, urgency}
+	return 42, nil
+}
+
+// serveNotifications serves a fakeNotifications with the given capabilities on
+// the bus at addr.
+func serveNotifications(t *testing.T, addr string, caps ...string) (*dbus.Conn, <-chan notification) {
+	t.Helper()
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	f := &fakeNotifications{caps, make(chan notification, 1)}
+	if err := conn.Export(f, notificationsPath, notificationsIface); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(notificationsName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("want: primary owner of %s; got: %v (%v)", notificationsName, reply, err)
+	}
+	return conn, f.ch
+}
+
+func TestDesktop(t *testing.T) {
+	tests := []struct {
+		name        string
+		caps        []string
+		code        int32
+		wantUrgency byte
+		wantActions []string
+	}{
+		{"ok", []string{"actions", "body"}, 0, urgencyNormal, []string{"default", "Focus"}},
+		{"failed", []string{"actions", "body"}, 1, urgencyCritical, []string{"default", "Focus"}},
+		{"no actions", []string{"body"}, 0, urgencyNormal, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr := privateBus(t)
+			server, ch := serveNotifications(t, addr, test.caps...)
+			focused := filepath.Join(t.TempDir(), "focused")
+			d := NewDesktop(addr, "touch "+focused)
+			t.Cleanup(func() { d.Close() })
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			e := &Event{Command: "make test", ReturnCode: test.code, StartTime: time.Now()}
+			if err := d.Notify(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+			got := <-ch
+			if got.summary != e.Title() || got.body != e.Body() {
+				t.Errorf("want: %q, %q; got: %q, %q", e.Title(), e.Body(), got.summary, got.body)
+			}
+			if got.urgency != test.wantUrgency {
+				t.Errorf("urgency: want: %d; got: %d", test.wantUrgency, got.urgency)
+			}
+			if strings.Join(got.actions, ",") != strings.Join(test.wantActions, ",") {
+				t.Errorf("actions: want: %q; got: %q", test.wantActions, got.actions)
+			}
+			if test.wantActions == nil {
+				return
+			}
+			err := server.Emit(notificationsPath, notificationsIface+".ActionInvoked", uint32(42), "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for {
+				if _, err := os.Stat(focused); err == nil {
+					break
+				}
+				select {
+				case <-ctx.Done():
+					t.Fatal("want: focus-command run on click; got: not run")
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
+
+func TestDesktopClose(t *testing.T) {
+	addr := privateBus(t)
+	_, ch := serveNotifications(t, addr, "actions")
+	d := NewDesktop(addr, "true")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Notify(ctx, &Event{Message: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	conn := d.conn
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if conn.Connected() {
+		t.Error("want: disconnected from the bus; got: still connected")
+	}
+	if err := d.Notify(ctx, &Event{Message: "hello"}); err == nil {
+		t.Error("want: error notifying once closed; got: nil")
+	}
+}
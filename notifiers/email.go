@@ -0,0 +1,212 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avamsi/ergo"
+)
+
+func init() {
+	Register("email", func(opts Options) (Notifier, error) {
+		return NewEmail(EmailOptions{
+			Addr:     opts.String("addr"),
+			Username: opts.String("username"),
+			Password: opts.String("password"),
+			From:     opts.String("from"),
+			To:       opts.StringSlice("to"),
+			Insecure: opts.Bool("insecure"),
+			Digest:   opts.Duration("digest"),
+		})
+	})
+}
+
+type EmailOptions struct {
+	Addr     string // host:port of the SMTP server
+	Username string // for (PLAIN) auth, if any
+	Password string
+	From     string
+	To       []string
+	// Insecure allows sending mail without STARTTLS (only meant for local SMTP
+	// servers, since the password would be sent in the clear otherwise).
+	Insecure bool
+	// Digest, if non-zero, batches all the events within the duration (since
+	// the first event) into one email.
+	Digest time.Duration
+}
+
+// Email sends notifications as (plain-text) emails over SMTP. For example,
+//
+//	notifiers:
+//	  email:
+//	    addr: smtp.gmail.com:587
+//	    username: heimdall@gmail.com
+//	    password: ...
+//	    from: heimdall@gmail.com
+//	    to: [me@example.com]
+//	    digest: 5m
+type Email struct {
+	opts EmailOptions
+	host string
+
+	mu     sync.Mutex
+	digest []*Event // events waiting to be sent (in digest mode)
+}
+
+// headerText makes s safe for use as an (unstructured) header value, flattening
+// it to a single line (multi-line commands are common enough) and encoding it
+// as per RFC 2047 if it's not all ASCII.
+func headerText(s string) string {
+	lines := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	})
+	s = strings.Join(lines, " ")
+	for _, r := range s {
+		if r > '~' {
+			return mime.QEncoding.Encode("utf-8", s)
+		}
+	}
+	return s
+}
+
+func (e *Email) write(w *bytes.Buffer, subject string, events []*Event) {
+	header := func(k, v string) {
+		fmt.Fprintf(w, "%s: %s\r\n", k, v)
+	}
+	header("From", e.opts.From)
+	header("To", strings.Join(e.opts.To, ", "))
+	header("Subject", headerText(subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	w.WriteString("\r\n")
+	for i, event := range events {
+		if i > 0 {
+			w.WriteString("\r\n---\r\n\r\n")
+		}
+		w.WriteString(strings.ReplaceAll(event.Text(), "\n", "\r\n"))
+		w.WriteString("\r\n")
+	}
+}
+
+func (e *Email) send(ctx context.Context, subject string, events []*Event) (err error) {
+	defer ergo.Annotate(&err, "failed to notify on email")
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.opts.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return err
+		}
+	} else if !e.opts.Insecure {
+		return errors.New("want: STARTTLS support; got: none (see insecure)")
+	}
+	if e.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.opts.Username, e.opts.Password, e.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.opts.From); err != nil {
+		return err
+	}
+	for _, to := range e.opts.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	e.write(&body, subject, events)
+	if _, err := w.Write(body.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func emailSubject(events []*Event) string {
+	if len(events) == 1 {
+		e := events[0]
+		if e.ReturnCode != 0 {
+			return fmt.Sprintf("%s (exited with %d)", e.Title(), e.ReturnCode)
+		}
+		return e.Title()
+	}
+	failed := 0
+	for _, e := range events {
+		if e.ReturnCode != 0 {
+			failed++
+		}
+	}
+	return fmt.Sprintf("heimdall: %d commands (%d failed)", len(events), failed)
+}
+
+func (e *Email) flush() {
+	e.mu.Lock()
+	events := e.digest
+	e.digest = nil
+	e.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 42*time.Second)
+	defer cancel()
+	// There's no caller to return the error to at this point (Notify returned
+	// long ago), so the best we can do is to log it (for each of the events, so
+	// that none of them go missing without a trace).
+	if err := e.send(ctx, emailSubject(events), events); err != nil {
+		for _, event := range events {
+			log.Printf("%s (dropped %q)\n", err.Error(), event.Title())
+		}
+	}
+}
+
+func (e *Email) Notify(ctx context.Context, event *Event) error {
+	if e.opts.Digest == 0 {
+		events := []*Event{event}
+		return e.send(ctx, emailSubject(events), events)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// The first event in a digest starts the clock, the rest just tag along.
+	if len(e.digest) == 0 {
+		time.AfterFunc(e.opts.Digest, e.flush)
+	}
+	e.digest = append(e.digest, event)
+	return nil
+}
+
+func NewEmail(opts EmailOptions) (_ *Email, err error) {
+	defer ergo.Annotate(&err, "failed to create new email notifier")
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.From == "" || len(opts.To) == 0 {
+		return nil, fmt.Errorf("want: from and to; got: %q and %q", opts.From, opts.To)
+	}
+	return &Email{opts: opts, host: host}, nil
+}
@@ -0,0 +1,218 @@
+package notifiers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a bare-bones SMTP server (no STARTTLS, no auth) that sends the
+// data of the messages it accepts on the returned channel.
+func fakeSMTP(t *testing.T) (addr string, msgs <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	ch := make(chan string, 42)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			serveSMTP(conn, ch)
+		}
+	}()
+	return lis.Addr().String(), ch
+}
+
+func serveSMTP(conn net.Conn, ch chan<- string) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb, _, _ := strings.Cut(line, " "); strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 fake")
+		case "MAIL", "RCPT":
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			ch <- string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string // decoded subject
+	}{
+		{"simple", "make test", "$ make test (exited with 2)"},
+		{"multi-line", "for i in 1 2\ndo\r\n  echo $i\ndone", "$ for i in 1 2 do   echo $i done (exited with 2)"},
+		{"non-ascii", "echo héllo 🚀", "$ echo héllo 🚀 (exited with 2)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr, msgs := fakeSMTP(t)
+			n, err := NewEmail(EmailOptions{
+				Addr:     addr,
+				From:     "heimdall@example.com",
+				To:       []string{"me@example.com"},
+				Insecure: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			e := &Event{Command: test.command, ReturnCode: 2, StartTime: time.Now()}
+			if err := n.Notify(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+			msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(<-msgs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k := range msg.Header {
+				switch k {
+				case "From", "To", "Subject", "Date", "Mime-Version", "Content-Type":
+				default:
+					t.Errorf("unexpected header %q", k)
+				}
+			}
+			got, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("want: %q; got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	addr, msgs := fakeSMTP(t)
+	const digest = 100 * time.Millisecond
+	n, err := NewEmail(EmailOptions{
+		Addr:     addr,
+		From:     "heimdall@example.com",
+		To:       []string{"me@example.com"},
+		Insecure: true,
+		Digest:   digest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := []string{"make", "make test", "make install"}
+	for i, cmd := range cmds {
+		e := &Event{Command: cmd, ReturnCode: int32(i % 2), StartTime: time.Now()}
+		if err := n.Notify(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var data string
+	select {
+	case data = <-msgs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want: digest sent; got: nothing")
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := msg.Header.Get("Subject"), "heimdall: 3 commands (1 failed)"; got != want {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if !strings.Contains(string(body), "$ "+cmd+"\n") {
+			t.Errorf("want: %q in the digest; got: %q", cmd, body)
+		}
+	}
+	select {
+	case data := <-msgs:
+		t.Errorf("want: just the one digest; got: another %q", data)
+	case <-time.After(3 * digest):
+	}
+}
+
+// lineWriter sends what's written to it (say, log lines) on lines.
+type lineWriter struct {
+	lines chan string
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w.lines <- string(p)
+	return len(p), nil
+}
+
+func TestEmailDigestDropped(t *testing.T) {
+	// Nothing's listening on addr once the listener is closed.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	w := lineWriter{make(chan string, 42)}
+	log.SetOutput(w)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	n, err := NewEmail(EmailOptions{
+		Addr:     addr,
+		From:     "heimdall@example.com",
+		To:       []string{"me@example.com"},
+		Insecure: true,
+		Digest:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := []string{"make", "make test"}
+	for _, cmd := range cmds {
+		if err := n.Notify(context.Background(), &Event{Command: cmd}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, cmd := range cmds {
+		select {
+		case line := <-w.lines:
+			if want := fmt.Sprintf("(dropped %q)", "$ "+cmd); !strings.Contains(line, want) {
+				t.Errorf("want: %s logged; got: %q", want, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("want: %q dropped and logged; got: nothing", cmd)
+		}
+	}
+}
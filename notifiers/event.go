@@ -0,0 +1,75 @@
+package notifiers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is what notifiers notify on, which is usually a command that's done
+// running (but can also be just a message, as with heimdall notify).
+type Event struct {
+	Command    string        `json:"command,omitempty"`
+	ID         string        `json:"id,omitempty"`
+	StartTime  time.Time     `json:"start_time"`
+	Duration   time.Duration `json:"duration"`
+	ReturnCode int32         `json:"return_code"`
+	Username   string        `json:"username,omitempty"`
+	Hostname   string        `json:"hostname,omitempty"`
+	Cwd        string        `json:"cwd,omitempty"`
+	// Reason is why bifrost decided to notify on the command.
+	Reason string `json:"reason,omitempty"`
+	// SlowerBy, if set, is how many times slower than usual (its historical
+	// p90) the command ran, which is only set if notably so.
+	SlowerBy float64 `json:"slower_by,omitempty"`
+	// Message, if set, is sent as is instead of the (notifier specific)
+	// rendering of the command.
+	Message string `json:"message,omitempty"`
+}
+
+// Title summarizes the event in a single line.
+func (e *Event) Title() string {
+	if e.Command == "" {
+		return "heimdall"
+	}
+	return "$ " + e.Command
+}
+
+// Body renders everything but the title of the event as plain text.
+func (e *Event) Body() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Started at %s, took %s", e.StartTime.Local().Format(time.Kitchen), e.Duration)
+	if e.ReturnCode != 0 {
+		fmt.Fprintf(&b, " and exited with %d", e.ReturnCode)
+	}
+	fmt.Fprintf(&b, ".\n%s@%s", e.Username, e.Hostname)
+	if e.Cwd != "" {
+		fmt.Fprintf(&b, ":%s", e.Cwd)
+	}
+	if e.SlowerBy != 0 {
+		fmt.Fprintf(&b, "\n%s", e.Slow())
+	}
+	return b.String()
+}
+
+// Slow renders SlowerBy, as in "🐢 3x slower than usual" (or "" if unset).
+func (e *Event) Slow() string {
+	if e.SlowerBy == 0 {
+		return ""
+	}
+	x := strconv.FormatFloat(math.Round(e.SlowerBy*10)/10, 'f', -1, 64)
+	return "🐢 " + x + "x slower than usual"
+}
+
+// Text renders the event as plain text.
+func (e *Event) Text() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return e.Title() + "\n\n" + e.Body()
+}
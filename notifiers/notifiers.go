@@ -0,0 +1,111 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+type Notifier interface {
+	Notify(ctx context.Context, e *Event) (err error)
+}
+
+// Options are the (backend specific) options of a single notifier instance,
+// as configured under the "notifiers" key in heimdall.yaml.
+type Options map[string]any
+
+func (o Options) String(key string) string {
+	return cast.ToString(o[key])
+}
+
+func (o Options) StringMap(key string) map[string]string {
+	return cast.ToStringMapString(o[key])
+}
+
+func (o Options) StringSlice(key string) []string {
+	return cast.ToStringSlice(o[key])
+}
+
+func (o Options) Bool(key string) bool {
+	return cast.ToBool(o[key])
+}
+
+func (o Options) Duration(key string) time.Duration {
+	return cast.ToDuration(o[key])
+}
+
+// Factory creates a new notifier from its options.
+type Factory func(opts Options) (Notifier, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a notifier backend available under the given type. It's meant
+// to be called from the init function of the backend and panics if the type is
+// already registered.
+func Register(typ string, f Factory) {
+	if _, ok := factories[typ]; ok {
+		panic(fmt.Sprintf("notifier type %q is already registered", typ))
+	}
+	factories[typ] = f
+}
+
+// privileged are the options (by backend type) that get bifrost to run commands
+// (or the like) on the config's say-so.
+var privileged = map[string][]string{}
+
+// Privileged marks the given options of a backend type as privileged, which are
+// only allowed in bifrost's own config (see NewUntrusted). It's meant to be
+// called from the init function of the backend, along with Register.
+func Privileged(typ string, keys ...string) {
+	privileged[typ] = append(privileged[typ], keys...)
+}
+
+// Type returns the backend type of a notifier instance, which defaults to the
+// name of the instance if not set explicitly (so "chat: {webhook-url: ...}"
+// just works, for example).
+func Type(name string, opts Options) string {
+	if typ := opts.String("type"); typ != "" {
+		return typ
+	}
+	return name
+}
+
+// Registered reports whether a backend is registered for the given type.
+func Registered(typ string) bool {
+	_, ok := factories[typ]
+	return ok
+}
+
+// New creates all the given notifier instances, keyed by instance name.
+func New(cfgs map[string]Options) (map[string]Notifier, error) {
+	ns := map[string]Notifier{}
+	for name, opts := range cfgs {
+		typ := Type(name, opts)
+		f, ok := factories[typ]
+		if !ok {
+			return nil, fmt.Errorf("notifier %q: unknown type %q", name, typ)
+		}
+		n, err := f(opts)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %w", name, err)
+		}
+		ns[name] = n
+	}
+	return ns, nil
+}
+
+// NewUntrusted is like New, but for configs that bifrost doesn't run for (i.e.,
+// those of other users in a multi-user bifrost, which may well run as root),
+// and so rejects privileged options (see Privileged).
+func NewUntrusted(cfgs map[string]Options) (map[string]Notifier, error) {
+	for name, opts := range cfgs {
+		for _, k := range privileged[Type(name, opts)] {
+			if opts.String(k) != "" {
+				return nil, fmt.Errorf("notifier %q: want: no %s (only allowed in bifrost's own config); got: %q", name, k, opts.String(k))
+			}
+		}
+	}
+	return New(cfgs)
+}
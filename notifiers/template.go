@@ -0,0 +1,62 @@
+package notifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"syscall"
+	"text/template"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ExitStatus names the return code of a command, as in "ok", "exit 2" or
+// "SIGINT" (for return codes above 128, which shells use for signals).
+func ExitStatus(code int32) string {
+	if code == 0 {
+		return "ok"
+	}
+	if code > 128 {
+		if name := unix.SignalName(syscall.Signal(code - 128)); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("exit %d", code)
+}
+
+var funcs = template.FuncMap{
+	// json encodes the value as JSON, so strings can be safely embedded in JSON
+	// (i.e., {"text": {{json .Text}}}), or the whole event sent as is (i.e.,
+	// {{json .}}).
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// duration rounds the duration to the second (i.e., {{duration .Duration}}).
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Second).String()
+	},
+	// time formats the time in the local time zone with the given layout (i.e.,
+	// {{time "15:04" .StartTime}}).
+	"time": func(layout string, t time.Time) string {
+		return t.Local().Format(layout)
+	},
+	// truncate truncates the string to at most n runes (i.e., {{truncate 42
+	// .Command}}), marking the truncation with an ellipsis.
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n && n > 0 {
+			return string(r[:n-1]) + "…"
+		}
+		return s
+	},
+	"exitStatus": ExitStatus,
+}
+
+// ParseTemplate parses a Go text/template over an Event, with some helpers to
+// format durations, times etc. (see funcs above). For example,
+//
+//	$ {{truncate 42 .Command}} ({{exitStatus .ReturnCode}})
+//	{{time "15:04" .StartTime}} + {{duration .Duration}} in {{.Cwd}}
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcs).Parse(text)
+}
@@ -0,0 +1,94 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/avamsi/ergo"
+)
+
+// defaultWebhookTemplate works as is for Slack, Mattermost and most of the
+// other incoming webhooks out there.
+const defaultWebhookTemplate = `{"text": {{json .Text}}}`
+
+func init() {
+	Register("webhook", func(opts Options) (Notifier, error) {
+		return NewWebhook(
+			opts.String("url"),
+			opts.String("method"),
+			opts.StringMap("headers"),
+			opts.String("template"))
+	})
+}
+
+// Webhook sends notifications as HTTP requests to an arbitrary URL, with the
+// request body rendered from a Go text/template over the Event (see
+// ParseTemplate). For example, for Discord,
+//
+//	notifiers:
+//	  discord:
+//	    type: webhook
+//	    url: https://discord.com/api/webhooks/...
+//	    template: '{"content": {{json .Text}}}'
+type Webhook struct {
+	url     string
+	method  string
+	headers map[string]string
+	tmpl    *template.Template
+	client  *http.Client
+}
+
+func (w *Webhook) Notify(ctx context.Context, e *Event) (err error) {
+	defer ergo.Annotate(&err, "failed to notify on webhook")
+	var body bytes.Buffer
+	if err := w.tmpl.Execute(&body, e); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, w.method, w.url, &body)
+	if err != nil {
+		return err
+	}
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 420))
+		return fmt.Errorf("want: 2xx; got: %s (%s)", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+// NewWebhook creates a new webhook notifier. The method defaults to POST and the
+// body template defaults to a JSON object with the event (as plain text) as
+// "text". Headers default to a JSON content type unless set explicitly.
+func NewWebhook(url, method string, headers map[string]string, tmpl string) (w *Webhook, err error) {
+	defer ergo.Annotate(&err, "failed to create new webhook notifier")
+	if url == "" {
+		return nil, errors.New("want: url; got: none")
+	}
+	if method == "" {
+		method = http.MethodPost
+	}
+	if tmpl == "" {
+		tmpl = defaultWebhookTemplate
+	}
+	t, err := ParseTemplate("webhook", tmpl)
+	if err != nil {
+		return nil, err
+	}
+	h := map[string]string{"Content-Type": "application/json"}
+	for k, v := range headers {
+		h[http.CanonicalHeaderKey(k)] = v
+	}
+	return &Webhook{url: url, method: method, headers: h, tmpl: t, client: http.DefaultClient}, nil
+}
@@ -0,0 +1,118 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is what fakeWebhook saw of a request.
+type request struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// fakeWebhook serves the given status, sending what it was requested with on
+// the returned channel.
+func fakeWebhook(t *testing.T, status int) (url string, reqs <-chan request) {
+	t.Helper()
+	ch := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- request{r.Method, r.Header, string(b)}
+		w.WriteHeader(status)
+		io.WriteString(w, "  some details\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, ch
+}
+
+func TestWebhook(t *testing.T) {
+	e := &Event{
+		Command:    "make test",
+		StartTime:  time.Now(),
+		Duration:   time.Minute,
+		ReturnCode: 2,
+		Username:   "avamsi",
+		Hostname:   "asgard",
+	}
+	tests := []struct {
+		name       string
+		method     string
+		headers    map[string]string
+		tmpl       string
+		wantMethod string
+		wantHeader http.Header
+		wantBody   string
+	}{
+		{
+			name:       "defaults",
+			wantMethod: http.MethodPost,
+			wantHeader: http.Header{"Content-Type": {"application/json"}},
+			wantBody:   `{"text": ` + mustJSON(t, e.Text()) + `}`,
+		},
+		{
+			name:       "custom",
+			method:     http.MethodPut,
+			headers:    map[string]string{"content-type": "text/plain", "x-api-key": "hunter2"},
+			tmpl:       "{{.Command}} ({{exitStatus .ReturnCode}})",
+			wantMethod: http.MethodPut,
+			wantHeader: http.Header{"Content-Type": {"text/plain"}, "X-Api-Key": {"hunter2"}},
+			wantBody:   "make test (exit 2)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			url, reqs := fakeWebhook(t, http.StatusNoContent)
+			w, err := NewWebhook(url, test.method, test.headers, test.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Notify(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+			got := <-reqs
+			if got.method != test.wantMethod {
+				t.Errorf("method: want: %s; got: %s", test.wantMethod, got.method)
+			}
+			for k, v := range test.wantHeader {
+				if g := got.header.Values(k); strings.Join(g, ",") != strings.Join(v, ",") {
+					t.Errorf("%s: want: %q; got: %q", k, v, g)
+				}
+			}
+			if got.body != test.wantBody {
+				t.Errorf("body: want: %q; got: %q", test.wantBody, got.body)
+			}
+		})
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	url, _ := fakeWebhook(t, http.StatusBadRequest)
+	w, err := NewWebhook(url, "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Notify(context.Background(), &Event{Message: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "400 Bad Request (some details)") {
+		t.Errorf("want: 400 Bad Request (some details); got: %v", err)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
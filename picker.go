@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var errPickerAborted = errors.New("picker aborted")
+
+// picker is a (bubbletea) multi-select list: up / down (or k / j) to move,
+// space to toggle, a to toggle all and enter to pick the toggled choices (or
+// just the one under the cursor, if none are toggled).
+type picker struct {
+	choices  []string
+	cursor   int
+	toggled  map[int]bool
+	picked   []int
+	aborted  bool
+	selected lipgloss.Style
+}
+
+func (p *picker) Init() tea.Cmd {
+	return nil
+}
+
+func (p *picker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return p, nil
+	}
+	switch key.String() {
+	case "up", "k":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "down", "j":
+		if p.cursor < len(p.choices)-1 {
+			p.cursor++
+		}
+	case " ", "x":
+		p.toggled[p.cursor] = !p.toggled[p.cursor]
+	case "a":
+		all := len(p.picks()) < len(p.choices)
+		for i := range p.choices {
+			p.toggled[i] = all
+		}
+	case "enter":
+		if p.picked = p.picks(); len(p.picked) == 0 {
+			p.picked = []int{p.cursor}
+		}
+		return p, tea.Quit
+	case "ctrl+c", "esc", "q":
+		p.aborted = true
+		return p, tea.Quit
+	}
+	return p, nil
+}
+
+func (p *picker) picks() []int {
+	picks := []int{}
+	for i := range p.choices {
+		if p.toggled[i] {
+			picks = append(picks, i)
+		}
+	}
+	return picks
+}
+
+func (p *picker) View() string {
+	if p.picked != nil || p.aborted {
+		return ""
+	}
+	var b strings.Builder
+	for i, c := range p.choices {
+		cursor, box := "  ", "[ ] "
+		if p.toggled[i] {
+			box = "[x] "
+		}
+		if i == p.cursor {
+			cursor, c = "» ", p.selected.Render(c)
+		}
+		b.WriteString(cursor + box + c + "\n")
+	}
+	b.WriteString("\n(space: toggle, a: toggle all, enter: done, q: quit)\n")
+	return b.String()
+}
+
+// pick lets the user pick any number of the choices, returning their indices.
+func pick(choices []string) ([]int, error) {
+	if len(choices) == 0 {
+		return nil, errors.New("nothing to pick from")
+	}
+	p := &picker{
+		choices:  choices,
+		toggled:  map[int]bool{},
+		selected: lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("32")),
+	}
+	if err := tea.NewProgram(p).Start(); err != nil {
+		return nil, err
+	}
+	if p.aborted {
+		return nil, errPickerAborted
+	}
+	return p.picked, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/avamsi/ergo"
+	"github.com/djherbis/atime"
+	"github.com/spf13/cast"
+
+	"github.com/avamsi/heimdall/bifrost"
+)
+
+// relayPoll is how often relay checks if its shell is still around.
+const relayPoll = 5 * time.Second
+
+type RelayOpts struct {
+	FIFO string // path of the FIFO to read the records from (removed on exit)
+	PID  int64  // pid of the shell, relay exits along with it
+}
+
+// Relay forwards the start and end records of a shell session to bifrost, so
+// that the shell hooks (see heimdall sh) just write to a FIFO instead of
+// spawning heimdall (and dialing bifrost) twice per command.
+//
+// Records are NUL terminated fields, the first of which is either start or end
+// and the rest are key=value flags of the same (plus force-notify for end, since
+// relay doesn't share the environment of the shell), terminated by an empty
+// field. For example,
+//
+//	printf 'end\0id=%s\0code=%d\0\0' "$id" "$code" > "$fifo"
+//
+// Relay exits (removing the FIFO, so that the hooks fall back to spawning
+// heimdall) on the first malformed record or error reading the FIFO, or soon
+// after the shell exits (even if its children, which inherit the FIFO, still
+// have it open). Failing to reach bifrost (say, while it restarts) is just
+// logged, so as not to leave the shell spawning heimdall for the rest of its
+// life.
+func (h Heimdall) Relay(opts RelayOpts) (err error) {
+	defer ergo.Annotate(&err, "relay")
+	defer os.Remove(opts.FIFO)
+	c := h.config()
+	client, err := bifrost.NewClient(c)
+	if err != nil {
+		return err
+	}
+	// Non-blocking, since there may not be a writer yet (the shell opens the
+	// FIFO only after starting relay).
+	f, err := os.OpenFile(opts.FIFO, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Relay holds a writer of its own, so that reads don't hit EOF whenever the
+	// shell doesn't have the FIFO open (before it opens it, say).
+	w, err := os.OpenFile(opts.FIFO, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	fr := &fifoReader{f: f}
+	// The terminal going away takes the shell with it, which is noticed below,
+	// after whatever the shell wrote last is forwarded.
+	signal.Ignore(syscall.SIGHUP)
+	exit := make(chan os.Signal, 1)
+	signal.Notify(exit, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-exit
+		os.Remove(opts.FIFO)
+		os.Exit(0)
+	}()
+	go func() {
+		for range time.Tick(relayPoll) {
+			// Signal 0 just checks if the process exists (or, at least, that it
+			// isn't a zombie yet).
+			if p, err := os.FindProcess(int(opts.PID)); err != nil || p.Signal(syscall.Signal(0)) != nil {
+				fr.drain()
+				return
+			}
+		}
+	}()
+	r := bufio.NewReader(fr)
+	for {
+		kind, fields, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch kind {
+		case "start":
+			opts, err := startRecord(fields)
+			if err != nil {
+				return err
+			}
+			if _, err := client.CommandStart(context.Background(), startRequest(opts)); err != nil {
+				log.Printf("relay: start %s: %v", opts.ID, err)
+			}
+		case "end":
+			opts, err := endRecord(fields)
+			if err != nil {
+				return err
+			}
+			// Unlike heimdall end, stdin isn't the terminal here.
+			var lastInteraction time.Time
+			if fi, err := os.Stat(opts.TTY); err == nil {
+				lastInteraction = atime.Get(fi)
+			}
+			req := endRequest(opts, cast.ToBool(fields["force-notify"]), lastInteraction)
+			if _, err := client.CommandEnd(context.Background(), req); err != nil {
+				log.Printf("relay: end %s: %v", opts.ID, err)
+			}
+		default:
+			return fmt.Errorf("want: start or end record; got: %q", kind)
+		}
+	}
+}
+
+// fifoReader reads from the FIFO, blocking for more as usual till drain is
+// called, after which it only reads what's left in the FIFO and then hits EOF.
+//
+// Relay can't just wait for EOF once the shell exits, since any long-lived
+// children of the shell (a tmux server or a nohup job, say) inherit the FIFO
+// and so keep it open for writing.
+type fifoReader struct {
+	f       *os.File
+	drained int32 // accessed atomically
+}
+
+func (fr *fifoReader) drain() {
+	atomic.StoreInt32(&fr.drained, 1)
+	// Interrupts the read that's blocked waiting for more, if any.
+	fr.f.SetReadDeadline(time.Now())
+}
+
+func (fr *fifoReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&fr.drained) == 0 {
+		n, err := fr.f.Read(p)
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			return n, err
+		}
+	}
+	// The deadline would fail the raw read below before it's even tried.
+	if err := fr.f.SetReadDeadline(time.Time{}); err != nil {
+		return 0, err
+	}
+	rc, err := fr.f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var (
+		n    int
+		rerr error
+	)
+	// Returning true reads just once (the FIFO is non-blocking), instead of
+	// waiting for the FIFO to be readable.
+	if err := rc.Read(func(fd uintptr) bool {
+		n, rerr = syscall.Read(int(fd), p)
+		return true
+	}); err != nil {
+		return 0, err
+	}
+	switch {
+	case n > 0:
+		return n, nil
+	case rerr == nil || errors.Is(rerr, syscall.EAGAIN):
+		return 0, io.EOF
+	default:
+		return 0, rerr
+	}
+}
+
+// readRecord reads the next record (see Relay) from r.
+func readRecord(r *bufio.Reader) (kind string, fields map[string]string, err error) {
+	fields = map[string]string{}
+	for {
+		field, err := r.ReadString(0)
+		if err != nil {
+			return "", nil, err
+		}
+		field = strings.TrimSuffix(field, "\x00")
+		switch {
+		case field == "":
+			return kind, fields, nil
+		case kind == "":
+			kind = field
+		default:
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				return "", nil, fmt.Errorf("want: key=value; got: %q", field)
+			}
+			fields[k] = v
+		}
+	}
+}
+
+// ints parses the given fields as ints (or 0 if they're not set).
+func ints(fields map[string]string, keys ...string) ([]int64, error) {
+	is := make([]int64, len(keys))
+	for j, k := range keys {
+		if fields[k] == "" {
+			continue
+		}
+		i, err := strconv.ParseInt(fields[k], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		is[j] = i
+	}
+	return is, nil
+}
+
+func startRecord(fields map[string]string) (StartOpts, error) {
+	is, err := ints(fields, "time", "pid")
+	if err != nil {
+		return StartOpts{}, err
+	}
+	return StartOpts{
+		Cmd:     fields["cmd"],
+		Time:    is[0],
+		ID:      fields["id"],
+		Cwd:     fields["cwd"],
+		TTY:     fields["tty"],
+		PID:     is[1],
+		Shell:   fields["shell"],
+		Session: fields["session"],
+	}, nil
+}
+
+func endRecord(fields map[string]string) (EndOpts, error) {
+	is, err := ints(fields, "start-time", "code", "pid")
+	if err != nil {
+		return EndOpts{}, err
+	}
+	return EndOpts{
+		Cmd:       fields["cmd"],
+		StartTime: is[0],
+		Code:      int32(is[1]),
+		ID:        fields["id"],
+		Cwd:       fields["cwd"],
+		TTY:       fields["tty"],
+		PID:       is[2],
+		Shell:     fields["shell"],
+		Session:   fields["session"],
+	}, nil
+}
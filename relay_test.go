@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	bpb "github.com/avamsi/heimdall/bifrost/proto"
+)
+
+func TestMain(m *testing.M) {
+	// Lets the benchmarks below spawn the test binary as heimdall itself.
+	if os.Getenv("HEIMDALL_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeBifrost just acknowledges starts and ends, sending the ids of the latter
+// on ends.
+type fakeBifrost struct {
+	bpb.UnimplementedBifrostServer
+	ends chan string
+}
+
+func (f *fakeBifrost) CommandStart(_ context.Context, req *bpb.CommandStartRequest) (*bpb.CommandStartResponse, error) {
+	return &bpb.CommandStartResponse{Id: req.GetCommand().GetId()}, nil
+}
+
+func (f *fakeBifrost) CommandEnd(_ context.Context, req *bpb.CommandEndRequest) (*bpb.CommandEndResponse, error) {
+	f.ends <- req.GetCommand().GetId()
+	return &bpb.CommandEndResponse{}, nil
+}
+
+// serveFakeBifrost serves a fakeBifrost on a Unix socket, with HOME pointed at
+// a config (for both the benchmark and the heimdalls it spawns) to match.
+func serveFakeBifrost(b *testing.B) (dir string, ends <-chan string) {
+	b.Helper()
+	// Not b.TempDir, which can be too long a path for a Unix socket.
+	dir, err := os.MkdirTemp("", "heimdall")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "heimdall.sock")
+	cfg := fmt.Sprintf("bifrost:\n  socket: %s\nnotifiers:\n  webhook:\n    url: http://127.0.0.1:1/\n", socket)
+	if err := os.MkdirAll(filepath.Join(dir, ".config"), 0o700); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".config", "heimdall.yaml"), []byte(cfg), 0o600); err != nil {
+		b.Fatal(err)
+	}
+	b.Setenv("HOME", dir)
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		b.Fatal(err)
+	}
+	f := &fakeBifrost{ends: make(chan string, 1)}
+	gs := grpc.NewServer()
+	bpb.RegisterBifrostServer(gs, f)
+	go gs.Serve(lis)
+	b.Cleanup(gs.Stop)
+	return dir, f.ends
+}
+
+// BenchmarkHooks compares what the shell hooks (see heimdall sh) cost per
+// command, either writing start and end records to relay or spawning heimdall
+// start and end (as they fall back to), till bifrost sees the end.
+func BenchmarkHooks(b *testing.B) {
+	dir, ends := serveFakeBifrost(b)
+	b.Run("relay", func(b *testing.B) {
+		fifo := filepath.Join(dir, fmt.Sprintf("relay-%d.fifo", b.N))
+		if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+			b.Fatal(err)
+		}
+		go func() {
+			if err := (Heimdall{}).Relay(RelayOpts{FIFO: fifo, PID: int64(os.Getpid())}); err != nil {
+				b.Error(err)
+			}
+		}()
+		// Blocks till relay opens the FIFO for reading.
+		w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer w.Close()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			id := fmt.Sprintf("relay.%d", i)
+			fmt.Fprintf(w, "start\x00id=%s\x00cmd=true\x00\x00", id)
+			fmt.Fprintf(w, "end\x00id=%s\x00cmd=true\x00code=0\x00\x00", id)
+			if got := <-ends; got != id {
+				b.Fatalf("want: %s; got: %s", id, got)
+			}
+		}
+	})
+	b.Run("spawn", func(b *testing.B) {
+		heimdall := func(args ...string) {
+			cmd := exec.Command(os.Args[0], args...)
+			cmd.Env = append(os.Environ(), "HEIMDALL_TEST_MAIN=1")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				b.Fatalf("%v: %s", err, out)
+			}
+		}
+		for i := 0; i < b.N; i++ {
+			id := fmt.Sprintf("spawn.%d", i)
+			heimdall("start", "--id", id, "--cmd", "true")
+			heimdall("end", "--id", id, "--cmd", "true", "--code", "0")
+			if got := <-ends; got != id {
+				b.Fatalf("want: %s; got: %s", id, got)
+			}
+		}
+	})
+}
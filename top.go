@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/avamsi/heimdall/notifiers"
+
+	bpb "github.com/avamsi/heimdall/bifrost/proto"
+)
+
+// topRecent is how many of the recently finished commands top shows.
+const topRecent = 10
+
+type (
+	watchMsg struct{ e *bpb.WatchResponse }
+	errMsg   struct{ err error } // the stream broke, so there's nothing more to show
+	tickMsg  struct{}
+	mutedMsg struct {
+		id    string
+		muted bool
+		err   error
+	}
+)
+
+var (
+	topHeader   = lipgloss.NewStyle().Bold(true)
+	topSelected = lipgloss.NewStyle().Reverse(true)
+	topFailed   = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	topFaint    = lipgloss.NewStyle().Faint(true)
+)
+
+// top is the (bubbletea) model of heimdall top, kept up to date by Watch (and a
+// tick every second, for the elapsed times).
+type top struct {
+	client bpb.BifrostClient
+	stream bpb.Bifrost_WatchClient
+
+	running  map[string]*bpb.Command // string is the command ID
+	finished []*bpb.WatchResponse    // most recent first
+	muted    map[string]bool         // string is the command ID
+	cursor   int
+	status   string
+	width    int
+
+	waitID string // set if the user chose to wait on a command
+	err    error
+}
+
+func (t *top) next() tea.Msg {
+	e, err := t.stream.Recv()
+	if err != nil {
+		return errMsg{err}
+	}
+	return watchMsg{e}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func (t *top) Init() tea.Cmd {
+	return tea.Batch(t.next, tick())
+}
+
+// rows returns the running commands (oldest first), followed by the finished
+// ones (most recent first), which is also the order they're rendered in.
+func (t *top) rows() (running []*bpb.Command, finished []*bpb.WatchResponse) {
+	for _, cmd := range t.running {
+		running = append(running, cmd)
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].GetStartTime().AsTime().Before(running[j].GetStartTime().AsTime())
+	})
+	return running, t.finished
+}
+
+func (t *top) selected() (cmd *bpb.Command, running bool) {
+	r, f := t.rows()
+	if t.cursor < len(r) {
+		return r[t.cursor], true
+	}
+	if i := t.cursor - len(r); i < len(f) {
+		return f[i].GetCommand(), false
+	}
+	return nil, false
+}
+
+func (t *top) observe(e *bpb.WatchResponse) {
+	id := e.GetCommand().GetId()
+	switch e.GetType() {
+	case bpb.WatchResponse_STARTED:
+		t.running[id] = e.GetCommand()
+	case bpb.WatchResponse_ENDED:
+		delete(t.running, id)
+		delete(t.muted, id)
+		// The same command may be seen both in the history (that top is seeded
+		// with) and in Watch, if it ended right as top was starting up.
+		for i, f := range t.finished {
+			if f.GetCommand().GetId() == id {
+				t.finished = append(t.finished[:i], t.finished[i+1:]...)
+				break
+			}
+		}
+		t.finished = append([]*bpb.WatchResponse{e}, t.finished...)
+		if len(t.finished) > topRecent {
+			t.finished = t.finished[:topRecent]
+		}
+	}
+	if n := len(t.running) + len(t.finished); t.cursor >= n && n > 0 {
+		t.cursor = n - 1
+	}
+}
+
+func (t *top) mute(id string, muted bool) tea.Cmd {
+	return func() tea.Msg {
+		_, err := t.client.MuteCommand(context.Background(), &bpb.MuteCommandRequest{
+			Id:     id,
+			Unmute: !muted,
+		})
+		return mutedMsg{id, muted, err}
+	}
+}
+
+func (t *top) onKey(key tea.KeyMsg) tea.Cmd {
+	cmd, running := t.selected()
+	switch key.String() {
+	case "up", "k":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case "down", "j":
+		if t.cursor < len(t.running)+len(t.finished)-1 {
+			t.cursor++
+		}
+	case "w":
+		if cmd != nil {
+			t.waitID = cmd.GetId()
+			return tea.Quit
+		}
+	case "m":
+		if cmd != nil && running {
+			return t.mute(cmd.GetId(), !t.muted[cmd.GetId()])
+		}
+		t.status = "only running commands can be muted"
+	case "c":
+		if cmd == nil {
+			break
+		}
+		if err := clipboard.WriteAll(cmd.GetId()); err != nil {
+			t.status = "failed to copy: " + err.Error()
+		} else {
+			t.status = "copied " + cmd.GetId()
+		}
+	case "q", "esc", "ctrl+c":
+		return tea.Quit
+	}
+	return nil
+}
+
+func (t *top) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case watchMsg:
+		t.observe(msg.e)
+		return t, t.next
+	case errMsg:
+		t.err = msg.err
+		return t, tea.Quit
+	case mutedMsg:
+		if msg.err != nil {
+			t.status = msg.err.Error()
+			break
+		}
+		t.muted[msg.id] = msg.muted
+		t.status = map[bool]string{true: "muted ", false: "unmuted "}[msg.muted] + msg.id
+	case tickMsg:
+		return t, tick()
+	case tea.WindowSizeMsg:
+		t.width = msg.Width
+	case tea.KeyMsg:
+		t.status = ""
+		return t, t.onKey(msg)
+	}
+	return t, nil
+}
+
+func (t *top) line(selected bool, s string, style lipgloss.Style) string {
+	if t.width > 0 && len([]rune(s)) > t.width {
+		s = string([]rune(s)[:t.width-1]) + "…"
+	}
+	if selected {
+		return topSelected.Render(s) + "\n"
+	}
+	return style.Render(s) + "\n"
+}
+
+func (t *top) View() string {
+	var (
+		b     strings.Builder
+		now   = time.Now()
+		row   = 0
+		plain = lipgloss.NewStyle()
+	)
+	running, finished := t.rows()
+	fmt.Fprintf(&b, "%s\n\n", topHeader.Render(fmt.Sprintf("heimdall top -- %d running", len(running))))
+	b.WriteString(topHeader.Render(fmt.Sprintf("%-20s  %-8s  %-9s  %-24s  %s", "ID", "START", "ELAPSED", "USER@HOST", "COMMAND")) + "\n")
+	for _, cmd := range running {
+		s := fmt.Sprintf("%-20s  %-8s  %-9s  %-24s  $ %s",
+			cmd.GetId(),
+			cmd.GetStartTime().AsTime().Local().Format(time.Kitchen),
+			now.Sub(cmd.GetStartTime().AsTime()).Round(time.Second),
+			cmd.GetUsername()+"@"+cmd.GetHostname(),
+			cmd.GetCommand())
+		style := plain
+		if t.muted[cmd.GetId()] {
+			s, style = s+"  (muted)", topFaint
+		}
+		b.WriteString(t.line(row == t.cursor, s, style))
+		row++
+	}
+	b.WriteString("\n" + topHeader.Render(fmt.Sprintf("%-20s  %-8s  %-9s  %-24s  %s", "ID", "END", "TOOK", "STATUS", "COMMAND")) + "\n")
+	for _, e := range finished {
+		cmd, r := e.GetCommand(), e.GetResult()
+		took := "?"
+		if r.Duration != nil {
+			took = r.GetDuration().AsDuration().Round(time.Second).String()
+		}
+		s := fmt.Sprintf("%-20s  %-8s  %-9s  %-24s  $ %s",
+			cmd.GetId(),
+			r.GetEndTime().AsTime().Local().Format(time.Kitchen),
+			took,
+			notifiers.ExitStatus(r.GetReturnCode()),
+			cmd.GetCommand())
+		style := plain
+		if r.GetReturnCode() != 0 {
+			style = topFailed
+		}
+		b.WriteString(t.line(row == t.cursor, s, style))
+		row++
+	}
+	fmt.Fprintf(&b, "\n%s\n", topFaint.Render("w: wait, m: (un)mute, c: copy id, q: quit"))
+	if t.status != "" {
+		b.WriteString(t.status + "\n")
+	}
+	return b.String()
+}